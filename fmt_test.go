@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFmtFlags(t *testing.T) {
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy.lox")
+	tidy := filepath.Join(dir, "tidy.lox")
+	broken := filepath.Join(dir, "broken.lox")
+	files := map[string]string{messy: "1+2 // sum\n", tidy: "1 + 2 // sum\n", broken: "* 1\n"}
+	for path, source := range files {
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	actual := runGolox(t, "fmt", "--check", messy, tidy)
+	if !slices.Equal(actual.stdout, []string{messy}) || actual.stderr != nil || actual.status != 1 {
+		t.Errorf("--check: got %+v, want %s listed and status 1", actual, messy)
+	}
+	actual = runGolox(t, "fmt", "--check", tidy)
+	if actual.stdout != nil || actual.status != 0 {
+		t.Errorf("--check on a formatted file: got %+v", actual)
+	}
+
+	actual = runGolox(t, "fmt", "-w", broken, messy, tidy)
+	want := []string{"[" + broken + ":1:1] Error at '*': Expect expression.", " 1 | * 1", "   | ^"}
+	if actual.stdout != nil || !slices.Equal(actual.stderr, want) || actual.status != 65 {
+		t.Errorf("-w: got %+v, want the error for %s and status 65", actual, broken)
+	}
+	for path, source := range files {
+		if path == messy {
+			source = files[tidy]
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil || string(contents) != source {
+			t.Errorf("-w: %s holds %q, want %q", path, contents, source)
+		}
+	}
+}
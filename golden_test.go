@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/elordeiro/GoLox/lox"
+)
+
+var update = flag.Bool("update", false, "rewrite the expectations in testdata from the actual output")
+
+// golox is the binary built by TestMain, the suite runs the command line
+// itself so flags, file handling and exit statuses are covered too.
+var golox string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "golox")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	golox = filepath.Join(dir, "golox")
+	build := exec.Command("go", "build", "-o", golox, ".")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "building golox:", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// Files under testdata/<mode>/ are run with that command and carry their
+// expected output in comments, like the Crafting Interpreters test suite:
+//
+//	1 + 2 // expect: 3
+//	-"a"  // expect runtime error: Operand must be a number.
+//	(1    // Error at end: Expect ')' after expression.
+//	// [line 2] Error at end: Expect ')' after expression.
+//
+// Every way a mode can run a file has to give the same result. run also
+// compiles the file and runs the .loxc.
+var goldenModes = map[string][]goldenRun{
+	"tokenize": {{"tokenize"}},
+	"parse":    {{"parse"}},
+	"evaluate": {{"evaluate"}, {"evaluate", "--backend=vm"}},
+	"run":      {{"run"}, {"run", "--backend=vm"}, {"compile"}},
+}
+
+// goldenRun holds the arguments before the filename.
+type goldenRun []string
+
+type expectation struct {
+	stdout []string
+	stderr []string
+	status int
+}
+
+func TestGolden(t *testing.T) {
+	err := filepath.WalkDir("testdata", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".lox" {
+			return err
+		}
+		name, _ := filepath.Rel("testdata", path)
+		runs, ok := goldenModes[strings.Split(filepath.ToSlash(name), "/")[0]]
+		if !ok {
+			t.Errorf("%s: not under a mode directory", path)
+			return nil
+		}
+		t.Run(filepath.ToSlash(name), func(t *testing.T) {
+			testGolden(t, path, runs)
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testGolden(t *testing.T, path string, runs []goldenRun) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := string(contents)
+
+	if *update {
+		if err := os.WriteFile(path, []byte(regenerate(t, source, runs[0])), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected := parseExpectations(expectationComments(source))
+	for _, run := range runs {
+		actual := runGolden(t, path, run)
+
+		name := strings.Join(run, " ")
+		if !slices.Equal(actual.stdout, expected.stdout) {
+			t.Errorf("%s: got stdout %q, want %q", name, actual.stdout, expected.stdout)
+		}
+		if !slices.Equal(actual.stderr, expected.stderr) {
+			t.Errorf("%s: got stderr %q, want %q", name, actual.stderr, expected.stderr)
+		}
+		if actual.status != expected.status {
+			t.Errorf("%s: exited with %d, want %d", name, actual.status, expected.status)
+		}
+	}
+}
+
+// runGolden runs golox on the file at path. compile writes a .loxc which is
+// then run, unless compiling already failed.
+func runGolden(t *testing.T, path string, run goldenRun) expectation {
+	if run[0] != "compile" {
+		return runGolox(t, append(slices.Clone(run), path)...)
+	}
+
+	compiled := filepath.Join(t.TempDir(), "golden.loxc")
+	actual := runGolox(t, "compile", "-o", compiled, path)
+	if actual.status != 0 {
+		return actual
+	}
+	return runGolox(t, "run", compiled)
+}
+
+func runGolox(t *testing.T, args ...string) expectation {
+	return runCommand(t, exec.Command(golox, args...))
+}
+
+func runCommand(t *testing.T, cmd *exec.Cmd) expectation {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+
+	actual := expectation{stdout: outputLines(stdout.String()), stderr: outputLines(stderr.String())}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		actual.status = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return actual
+}
+
+// A script run through its #! line gets no arguments, anything after it is
+// refused instead of being taken for flags or more files.
+func TestScriptArguments(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "tool.lox")
+	if err := os.WriteFile(script, []byte("#!"+golox+"\n(1 + 2) * 3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args     []string
+		expected expectation
+	}{
+		{nil, expectation{stdout: []string{"9"}}},
+		{[]string{"hello"}, expectation{stderr: []string{script + ": scripts take no arguments"}, status: 64}},
+		{[]string{"-v"}, expectation{stderr: []string{script + ": scripts take no arguments"}, status: 64}},
+		{[]string{script}, expectation{stderr: []string{script + ": scripts take no arguments"}, status: 64}},
+	}
+	for _, test := range tests {
+		for _, actual := range []expectation{
+			runCommand(t, exec.Command(script, test.args...)),
+			runGolox(t, append([]string{script}, test.args...)...),
+		} {
+			if !slices.Equal(actual.stdout, test.expected.stdout) || !slices.Equal(actual.stderr, test.expected.stderr) ||
+				actual.status != test.expected.status {
+				t.Errorf("tool.lox %q: got %+v, want %+v", test.args, actual, test.expected)
+			}
+		}
+	}
+}
+
+func outputLines(output string) []string {
+	if output == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+}
+
+func expectationComments(source string) []lox.Comment {
+	scanner := lox.NewScanner(source)
+	for {
+		token, _ := scanner.Next()
+		if token.Type == lox.EOF {
+			break
+		}
+	}
+
+	var comments []lox.Comment
+	for _, comment := range scanner.Comments {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+		if strings.HasPrefix(text, "expect: ") || strings.HasPrefix(text, "expect runtime error: ") ||
+			strings.HasPrefix(text, "Error") || strings.HasPrefix(text, "[line ") {
+			comments = append(comments, comment)
+		}
+	}
+	return comments
+}
+
+func parseExpectations(comments []lox.Comment) expectation {
+	var expected expectation
+	for _, comment := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+		if output, ok := strings.CutPrefix(text, "expect: "); ok {
+			expected.stdout = append(expected.stdout, output)
+		} else if message, ok := strings.CutPrefix(text, "expect runtime error: "); ok {
+			expected.stderr = append(expected.stderr, message, fmt.Sprintf("[line %d]", comment.Line))
+			expected.status = 70
+		} else if strings.HasPrefix(text, "Error") {
+			expected.stderr = append(expected.stderr, fmt.Sprintf("[line %d] %s", comment.Line, text))
+			expected.status = 65
+		} else {
+			expected.stderr = append(expected.stderr, text)
+			expected.status = 65
+		}
+	}
+	return expected
+}
+
+// regenerate writes the actual output as expectations. A runtime error is
+// expected on the line it happened and the output after the source, but with
+// syntax errors everything goes before it, since an unterminated string would
+// swallow anything that follows. Expectations above the source move it down,
+// so the file is run again until its line numbers settle.
+func regenerate(t *testing.T, source string, run goldenRun) string {
+	clean := stripExpectations(source)
+	updated := strings.Join(clean, "\n") + "\n"
+	path := filepath.Join(t.TempDir(), "golden.lox")
+	for range 3 {
+		if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
+			t.Fatal(err)
+		}
+		actual := runGolden(t, path, run)
+		next := placeExpectations(clean, actual)
+		if next == updated {
+			break
+		}
+		updated = next
+	}
+	return updated
+}
+
+// stripExpectations drops lines holding only an expectation and trims the
+// others.
+func stripExpectations(source string) []string {
+	lines := strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+	for _, comment := range expectationComments(source) {
+		lines[comment.Line-1] = strings.TrimRight(lines[comment.Line-1][:comment.Column-1], " \t")
+		if lines[comment.Line-1] == "" {
+			lines[comment.Line-1] = "\x00"
+		}
+	}
+	return slices.DeleteFunc(lines, func(line string) bool { return line == "\x00" })
+}
+
+func placeExpectations(clean []string, actual expectation) string {
+	lines := slices.Clone(clean)
+	var expectations []string
+	for _, output := range actual.stdout {
+		expectations = append(expectations, "// expect: "+output)
+	}
+	for i := 0; i < len(actual.stderr); i++ {
+		var line int
+		if actual.status == 70 && i+1 < len(actual.stderr) {
+			if _, err := fmt.Sscanf(actual.stderr[i+1], "[line %d]", &line); err == nil && line <= len(lines) {
+				lines[line-1] += " // expect runtime error: " + actual.stderr[i]
+				i++
+				continue
+			}
+		}
+		expectations = append(expectations, "// "+actual.stderr[i])
+	}
+
+	if actual.status == 65 {
+		lines = append(expectations, lines...)
+	} else {
+		lines = append(lines, expectations...)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// LineEditor reads lines with cursor movement and history when stdin is a
+// terminal, and plain lines otherwise.
+type LineEditor struct {
+	in          *bufio.Reader
+	out         io.Writer
+	fd          int
+	terminal    bool
+	history     []string
+	historyFile string
+	// complete returns the words that can replace the one ending at a byte
+	// offset in the line, and the offset where that word starts.
+	complete func(line string, cursor int) (int, []string)
+}
+
+var errInterrupt = errors.New("interrupt")
+
+const maxHistory = 1000
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+func NewLineEditor(historyFile string) *LineEditor {
+	e := &LineEditor{
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stdout,
+		fd:          int(os.Stdin.Fd()),
+		historyFile: historyFile,
+	}
+	e.terminal = isTerminal(e.fd)
+	e.loadHistory()
+	return e
+}
+
+// The history file defaults to ~/.golox_history, GOLOX_HISTORY overrides it
+// and an empty GOLOX_HISTORY turns saving off.
+func defaultHistoryFile() string {
+	if file, ok := os.LookupEnv("GOLOX_HISTORY"); ok {
+		return file
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".golox_history")
+}
+
+// ReadLine returns io.EOF on Ctrl-D at the start of an empty line and
+// errInterrupt when the line is abandoned with Ctrl-C.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	if !e.terminal {
+		line, err := e.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimSuffix(line, "\n"), err
+	}
+
+	state, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restoreTerm(e.fd, state)
+
+	line, err := e.edit(prompt)
+	fmt.Fprint(e.out, "\r\n")
+	return line, err
+}
+
+func (e *LineEditor) edit(prompt string) (string, error) {
+	var line []rune
+	cursor := 0
+	// Browsing history starts past the newest entry, which is the line being
+	// edited.
+	entry := len(e.history)
+	edited := ""
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - cursor; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	recall := func(to int) {
+		if to < 0 || to > len(e.history) {
+			return
+		}
+		if entry == len(e.history) {
+			edited = string(line)
+		}
+		entry = to
+		if entry == len(e.history) {
+			line = []rune(edited)
+		} else {
+			line = []rune(e.history[entry])
+		}
+		cursor = len(line)
+		redraw()
+	}
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			return string(line), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C")
+			return "", errInterrupt
+		case keyCtrlD:
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+			if cursor < len(line) {
+				line = append(line[:cursor], line[cursor+1:]...)
+			}
+		case keyBackspace, keyCtrlH:
+			if cursor > 0 {
+				line = append(line[:cursor-1], line[cursor:]...)
+				cursor--
+			}
+		case keyCtrlA:
+			cursor = 0
+		case keyCtrlE:
+			cursor = len(line)
+		case keyCtrlB:
+			cursor = max(cursor-1, 0)
+		case keyCtrlF:
+			cursor = min(cursor+1, len(line))
+		case keyCtrlK:
+			line = line[:cursor]
+		case keyCtrlU:
+			line = line[cursor:]
+			cursor = 0
+		case keyCtrlW:
+			start := cursor
+			for start > 0 && unicode.IsSpace(line[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(line[start-1]) {
+				start--
+			}
+			line = append(line[:start], line[cursor:]...)
+			cursor = start
+		case keyTab:
+			if e.complete == nil {
+				line = append(line[:cursor], append([]rune{r}, line[cursor:]...)...)
+				cursor++
+				break
+			}
+			text := string(line)
+			at := len(string(line[:cursor]))
+			start, candidates := e.complete(text, at)
+			if len(candidates) == 0 {
+				fmt.Fprint(e.out, "\a")
+				continue
+			}
+			insert := []rune(commonPrefix(candidates)[at-start:])
+			if len(insert) > 0 {
+				line = append(line[:cursor], append(insert, line[cursor:]...)...)
+				cursor += len(insert)
+			} else {
+				fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+			}
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP:
+			recall(entry - 1)
+			continue
+		case keyCtrlN:
+			recall(entry + 1)
+			continue
+		case keyEscape:
+			switch e.readEscape() {
+			case "[A":
+				recall(entry - 1)
+				continue
+			case "[B":
+				recall(entry + 1)
+				continue
+			case "[C":
+				cursor = min(cursor+1, len(line))
+			case "[D":
+				cursor = max(cursor-1, 0)
+			case "[H", "[1~", "OH":
+				cursor = 0
+			case "[F", "[4~", "OF":
+				cursor = len(line)
+			case "[3~":
+				if cursor < len(line) {
+					line = append(line[:cursor], line[cursor+1:]...)
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line[:cursor], append([]rune{r}, line[cursor:]...)...)
+				cursor++
+			}
+		}
+		redraw()
+	}
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// readEscape reads the rest of an escape sequence, like "[A" for the up
+// arrow.
+func (e *LineEditor) readEscape() string {
+	var sequence []byte
+	for {
+		b, err := e.in.ReadByte()
+		if err != nil {
+			return string(sequence)
+		}
+		sequence = append(sequence, b)
+		if len(sequence) > 1 && (b >= 'A' && b <= 'Z' || b == '~') {
+			return string(sequence)
+		}
+		if len(sequence) > 8 {
+			return ""
+		}
+	}
+}
+
+// AddHistory skips blank lines and repeats of the previous entry.
+func (e *LineEditor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	if e.historyFile == "" {
+		return
+	}
+
+	file, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(file, line)
+	file.Close()
+}
+
+func (e *LineEditor) loadHistory() {
+	if e.historyFile == "" {
+		return
+	}
+	contents, err := os.ReadFile(e.historyFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+		e.saveHistory()
+	}
+}
+
+// saveHistory rewrites the file so it does not grow past maxHistory lines.
+func (e *LineEditor) saveHistory() {
+	os.WriteFile(e.historyFile, []byte(strings.Join(e.history, "\n")+"\n"), 0600)
+}
@@ -0,0 +1,86 @@
+package lox
+
+import "sort"
+
+type OpCode byte
+
+const (
+	OpConstant OpCode = iota
+	OpConstantLong
+	OpNil
+	OpTrue
+	OpFalse
+	OpEqual
+	OpNotEqual
+	OpGreater
+	OpGreaterEqual
+	OpLess
+	OpLessEqual
+	OpAdd
+	OpSubtract
+	OpMultiply
+	OpDivide
+	OpNot
+	OpNegate
+	OpReturn
+	OpJump
+	OpJumpIfFalse
+)
+
+// Chunk is a compiled expression: the bytecode, the constants it refers to
+// and the source line and column of every byte.
+type Chunk struct {
+	Code      []byte
+	Constants []Value
+	Lines     []LineRun
+}
+
+// LineRun marks the first byte of a run of code compiled from the same
+// token, consecutive bytes from one place share a single entry.
+type LineRun struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func NewChunk() *Chunk {
+	return &Chunk{Code: []byte{}, Constants: []Value{}, Lines: []LineRun{}}
+}
+
+func (c *Chunk) Write(b byte, line int, column int) {
+	if len(c.Lines) == 0 || c.Lines[len(c.Lines)-1].Line != line || c.Lines[len(c.Lines)-1].Column != column {
+		c.Lines = append(c.Lines, LineRun{len(c.Code), line, column})
+	}
+	c.Code = append(c.Code, b)
+}
+
+func (c *Chunk) AddConstant(value Value) int {
+	c.Constants = append(c.Constants, value)
+	return len(c.Constants) - 1
+}
+
+// Jumps only go forward, by the three byte operand of the instruction at
+// offset counted from the end of the instruction.
+func (c *Chunk) jumpOffset(offset int) int {
+	return int(c.Code[offset+1])<<16 | int(c.Code[offset+2])<<8 | int(c.Code[offset+3])
+}
+
+func (c *Chunk) Line(offset int) int {
+	return c.run(offset).Line
+}
+
+// Column is 0 for code without one, like chunks from before columns were
+// recorded.
+func (c *Chunk) Column(offset int) int {
+	return c.run(offset).Column
+}
+
+func (c *Chunk) run(offset int) LineRun {
+	i := sort.Search(len(c.Lines), func(i int) bool {
+		return c.Lines[i].Offset > offset
+	})
+	if i == 0 {
+		return LineRun{}
+	}
+	return c.Lines[i-1]
+}
@@ -0,0 +1,293 @@
+package lox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// A .loxc file holds one compiled chunk:
+//
+//	magic "LOXC" | version uint16 | constants | code | line table | crc32
+//
+// Counts and lengths are uvarints, the version and checksum are little
+// endian and the checksum covers every byte before it.
+const ChunkFileVersion = 2
+
+var chunkFileMagic = []byte("LOXC")
+
+const (
+	constantNil byte = iota
+	constantFalse
+	constantTrue
+	constantNumber
+	constantString
+)
+
+var errTruncated = errors.New("file is truncated")
+
+func IsChunkFile(reader *bufio.Reader) bool {
+	header, _ := reader.Peek(len(chunkFileMagic))
+	return bytes.Equal(header, chunkFileMagic)
+}
+
+func (c *Chunk) Save(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.Write(chunkFileMagic)
+	buf.Write(binary.LittleEndian.AppendUint16(nil, ChunkFileVersion))
+
+	buf.Write(binary.AppendUvarint(nil, uint64(len(c.Constants))))
+	for _, constant := range c.Constants {
+		switch constant.Kind {
+		case ValNil:
+			buf.WriteByte(constantNil)
+		case ValBool:
+			if constant.AsBool() {
+				buf.WriteByte(constantTrue)
+			} else {
+				buf.WriteByte(constantFalse)
+			}
+		case ValNumber:
+			buf.WriteByte(constantNumber)
+			buf.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(constant.Number)))
+		case ValString:
+			chars := constant.AsString().Chars
+			buf.WriteByte(constantString)
+			buf.Write(binary.AppendUvarint(nil, uint64(len(chars))))
+			buf.WriteString(chars)
+		default:
+			return fmt.Errorf("cannot serialize constant of kind %d", constant.Kind)
+		}
+	}
+
+	buf.Write(binary.AppendUvarint(nil, uint64(len(c.Code))))
+	buf.Write(c.Code)
+
+	buf.Write(binary.AppendUvarint(nil, uint64(len(c.Lines))))
+	for _, run := range c.Lines {
+		buf.Write(binary.AppendUvarint(nil, uint64(run.Offset)))
+		buf.Write(binary.AppendUvarint(nil, uint64(run.Line)))
+		buf.Write(binary.AppendUvarint(nil, uint64(run.Column)))
+	}
+
+	buf.Write(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(buf.Bytes())))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func LoadChunk(r io.Reader) (*Chunk, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, chunkFileMagic) {
+		return nil, errors.New("not a compiled Lox file")
+	}
+	if len(data) < len(chunkFileMagic)+2+4 {
+		return nil, errTruncated
+	}
+	version := binary.LittleEndian.Uint16(data[len(chunkFileMagic):])
+	if version != ChunkFileVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d, expected %d", version, ChunkFileVersion)
+	}
+	body, checksum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, errors.New("checksum mismatch, file is corrupted")
+	}
+
+	reader := bytes.NewReader(body[len(chunkFileMagic)+2:])
+	chunk, err := readChunk(reader)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, errTruncated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reader.Len() != 0 {
+		return nil, errors.New("unexpected data after line table")
+	}
+	if err := chunk.verify(); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+func readChunk(reader *bytes.Reader) (*Chunk, error) {
+	chunk := NewChunk()
+
+	count, err := readLength(reader)
+	if err != nil {
+		return nil, err
+	}
+	for range count {
+		tag, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case constantNil:
+			chunk.AddConstant(NilValue())
+		case constantFalse:
+			chunk.AddConstant(BoolValue(false))
+		case constantTrue:
+			chunk.AddConstant(BoolValue(true))
+		case constantNumber:
+			var bits uint64
+			if err := binary.Read(reader, binary.LittleEndian, &bits); err != nil {
+				return nil, err
+			}
+			chunk.AddConstant(NumberValue(math.Float64frombits(bits)))
+		case constantString:
+			text, err := readBytes(reader)
+			if err != nil {
+				return nil, err
+			}
+			chunk.AddConstant(StringValue(&ObjString{Chars: string(text)}))
+		default:
+			return nil, fmt.Errorf("unknown constant tag %d", tag)
+		}
+	}
+
+	chunk.Code, err = readBytes(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err = readLength(reader)
+	if err != nil {
+		return nil, err
+	}
+	for range count {
+		offset, err := readLength(reader)
+		if err != nil {
+			return nil, err
+		}
+		line, err := readLength(reader)
+		if err != nil {
+			return nil, err
+		}
+		column, err := readLength(reader)
+		if err != nil {
+			return nil, err
+		}
+		chunk.Lines = append(chunk.Lines, LineRun{offset, line, column})
+	}
+	return chunk, nil
+}
+
+// Lengths can never exceed what is left of the file, checking that up front
+// keeps a corrupted count from allocating huge slices.
+func readLength(reader *bytes.Reader) (int, error) {
+	n, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(reader.Size()) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+func readBytes(reader *bytes.Reader) ([]byte, error) {
+	n, err := readLength(reader)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(reader, b)
+	return b, err
+}
+
+// verify walks the code once so the VM never reads an unknown opcode, a
+// missing operand, a constant outside the pool, jumps into the middle of an
+// instruction or pops an empty stack. Jumps only go forward, so the stack
+// depth at a jump target is known by the time the walk gets there.
+func (c *Chunk) verify() error {
+	// The depth every jump seen so far expects at its target
+	targets := map[int]int{}
+	depth := 0
+	var last OpCode
+	for offset := 0; offset < len(c.Code); {
+		op := OpCode(c.Code[offset])
+		last = op
+		if int(op) >= len(opCodeNames) {
+			return fmt.Errorf("unknown opcode %d at offset %d", byte(op), offset)
+		}
+
+		if target, ok := targets[offset]; ok {
+			if depth >= 0 && depth != target {
+				return fmt.Errorf("stack depth differs between paths at offset %d", offset)
+			}
+			depth = target
+			delete(targets, offset)
+		}
+		if depth < 0 {
+			return fmt.Errorf("unreachable code at offset %d", offset)
+		}
+
+		size, pops, pushes := 1, 0, 1
+		switch op {
+		case OpConstant:
+			size = 2
+		case OpConstantLong:
+			size = 4
+		case OpNil, OpTrue, OpFalse:
+		case OpNot, OpNegate:
+			pops = 1
+		case OpReturn:
+			pops, pushes = 1, 0
+		case OpJump:
+			size, pushes = 4, 0
+		case OpJumpIfFalse:
+			size, pops, pushes = 4, 1, 0
+		default:
+			pops = 2
+		}
+
+		if offset+size > len(c.Code) {
+			return fmt.Errorf("missing operand for %s at offset %d", op, offset)
+		}
+		if op == OpConstant || op == OpConstantLong {
+			index := int(c.Code[offset+1])
+			if op == OpConstantLong {
+				index = index<<16 | int(c.Code[offset+2])<<8 | int(c.Code[offset+3])
+			}
+			if index >= len(c.Constants) {
+				return fmt.Errorf("constant %d out of range at offset %d", index, offset)
+			}
+		}
+		if depth < pops {
+			return fmt.Errorf("stack underflow at offset %d", offset)
+		}
+
+		depth += pushes - pops
+		if op == OpJump || op == OpJumpIfFalse {
+			target := offset + size + c.jumpOffset(offset)
+			if target >= len(c.Code) {
+				return fmt.Errorf("jump out of range at offset %d", offset)
+			}
+			if expected, ok := targets[target]; ok && expected != depth {
+				return fmt.Errorf("stack depth differs between paths at offset %d", target)
+			}
+			targets[target] = depth
+		}
+		if op == OpJump || op == OpReturn {
+			// Nothing falls through, the next instruction must be a target
+			depth = -1
+		}
+		offset += size
+	}
+	if len(c.Code) == 0 || last != OpReturn {
+		return errors.New("code does not end with OP_RETURN")
+	}
+	if len(targets) > 0 {
+		return errors.New("jump into the middle of an instruction")
+	}
+	return nil
+}
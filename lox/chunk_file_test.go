@@ -0,0 +1,77 @@
+package lox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+func saveChunk(t *testing.T, chunk *Chunk) []byte {
+	t.Helper()
+	var file bytes.Buffer
+	if err := chunk.Save(&file); err != nil {
+		t.Fatal(err)
+	}
+	return file.Bytes()
+}
+
+// resign replaces the checksum so a modified file only fails on what changed
+func resign(data []byte) []byte {
+	body := data[:len(data)-4]
+	return binary.LittleEndian.AppendUint32(bytes.Clone(body), crc32.ChecksumIEEE(body))
+}
+
+func TestLoadChunk(t *testing.T) {
+	valid := saveChunk(t, (&Lox{}).CompileReader(strings.NewReader("1 < 2 ? \"yes\" : -3")))
+	if _, err := LoadChunk(bytes.NewReader(valid)); err != nil {
+		t.Fatalf("valid file: %v", err)
+	}
+
+	crafted := func(code ...byte) []byte {
+		chunk := NewChunk()
+		for range 18 {
+			chunk.AddConstant(NumberValue(1))
+		}
+		for _, b := range code {
+			chunk.Write(b, 1, 1)
+		}
+		return saveChunk(t, chunk)
+	}
+
+	badMagic := bytes.Clone(valid)
+	badMagic[0] = 'X'
+	badVersion := bytes.Clone(valid)
+	binary.LittleEndian.PutUint16(badVersion[len(chunkFileMagic):], ChunkFileVersion+1)
+	badChecksum := bytes.Clone(valid)
+	badChecksum[len(badChecksum)/2] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"bad magic", badMagic, "not a compiled Lox file"},
+		{"wrong version", resign(badVersion), "unsupported bytecode version"},
+		{"bad checksum", badChecksum, "checksum mismatch"},
+		{"header only", valid[:len(chunkFileMagic)+2], "file is truncated"},
+		{"truncated", resign(valid[:len(valid)/2]), "file is truncated"},
+		{"trailing data", resign(append(bytes.Clone(valid), 0)), "unexpected data"},
+		{"empty code", crafted(), "does not end with OP_RETURN"},
+		{"operand that looks like OP_RETURN", crafted(byte(OpConstant), byte(OpReturn)), "does not end with OP_RETURN"},
+		{"missing operand", crafted(byte(OpNil), byte(OpConstantLong), 0), "missing operand"},
+		{"unknown opcode", crafted(0xff, byte(OpReturn)), "unknown opcode 255"},
+		{"constant out of range", crafted(byte(OpConstant), 18, byte(OpReturn)), "constant 18 out of range"},
+		{"stack underflow", crafted(byte(OpNil), byte(OpAdd), byte(OpReturn)), "stack underflow"},
+		{"jump out of range", crafted(byte(OpJump), 0, 0, 9, byte(OpNil), byte(OpReturn)), "jump out of range"},
+		{"jump into an operand", crafted(byte(OpTrue), byte(OpJumpIfFalse), 0, 0, 1, byte(OpConstant), 0, byte(OpReturn)), "middle of an instruction"},
+		{"unreachable code", crafted(byte(OpNil), byte(OpReturn), byte(OpNil), byte(OpReturn)), "unreachable code"},
+	}
+	for _, test := range tests {
+		_, err := LoadChunk(bytes.NewReader(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
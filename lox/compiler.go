@@ -0,0 +1,136 @@
+package lox
+
+// Compiler turns an expression into a Chunk for the VM in a single walk
+// over the tree.
+type Compiler struct {
+	chunk *Chunk
+}
+
+func (c *Compiler) VisitExprTernary(ternary Ternary) any {
+	c.compile(ternary.Condition)
+
+	elseJump := c.emitJump(OpJumpIfFalse, ternary.Question)
+	c.compile(ternary.TrueExpr)
+	endJump := c.emitJump(OpJump, ternary.Question)
+	c.patchJump(elseJump)
+	c.compile(ternary.FalseExpr)
+	c.patchJump(endJump)
+	return nil
+}
+
+func (c *Compiler) VisitExprBinary(binary Binary) any {
+	c.compile(binary.Left)
+	c.compile(binary.Right)
+
+	at := binary.Operator
+	switch binary.Operator.Type {
+	case GREATER:
+		c.emit(OpGreater, at)
+	case GREATER_EQUAL:
+		c.emit(OpGreaterEqual, at)
+	case LESS:
+		c.emit(OpLess, at)
+	case LESS_EQUAL:
+		c.emit(OpLessEqual, at)
+	case BANG_EQUAL:
+		c.emit(OpNotEqual, at)
+	case EQUAL_EQUAL:
+		c.emit(OpEqual, at)
+	case MINUS:
+		c.emit(OpSubtract, at)
+	case PLUS:
+		c.emit(OpAdd, at)
+	case SLASH:
+		c.emit(OpDivide, at)
+	case STAR:
+		c.emit(OpMultiply, at)
+	}
+	return nil
+}
+
+func (c *Compiler) VisitExprGrouping(grouping Grouping) any {
+	c.compile(grouping.Expression)
+	return nil
+}
+
+func (c *Compiler) VisitExprLiteral(literal Literal) any {
+	at := literal.Token
+	switch literal.Value {
+	case nil:
+		c.emit(OpNil, at)
+	case true:
+		c.emit(OpTrue, at)
+	case false:
+		c.emit(OpFalse, at)
+	default:
+		c.emitConstant(ValueOf(literal.Value), at)
+	}
+	return nil
+}
+
+func (c *Compiler) VisitExprUnary(unary Unary) any {
+	c.compile(unary.Right)
+
+	at := unary.Operator
+	switch unary.Operator.Type {
+	case MINUS:
+		c.emit(OpNegate, at)
+	case BANG:
+		c.emit(OpNot, at)
+	}
+	return nil
+}
+
+func (c *Compiler) compile(expr Expr) {
+	expr.Accept(c)
+}
+
+// Errors in the instruction are reported at token's line and column.
+func (c *Compiler) emit(op OpCode, token Token) {
+	c.write(byte(op), token)
+}
+
+func (c *Compiler) write(b byte, token Token) {
+	c.chunk.Write(b, token.Line, token.Column)
+}
+
+// Constants past the 256th are addressed with a three byte operand.
+func (c *Compiler) emitConstant(value Value, token Token) {
+	index := c.chunk.AddConstant(value)
+	if index <= 0xff {
+		c.emit(OpConstant, token)
+		c.write(byte(index), token)
+		return
+	}
+
+	c.emit(OpConstantLong, token)
+	c.write(byte(index>>16), token)
+	c.write(byte(index>>8), token)
+	c.write(byte(index), token)
+}
+
+// emitJump leaves the three byte operand to be filled in by patchJump once
+// the target is known, and returns where it is.
+func (c *Compiler) emitJump(op OpCode, token Token) int {
+	c.emit(op, token)
+	for range 3 {
+		c.write(0xff, token)
+	}
+	return len(c.chunk.Code) - 3
+}
+
+// patchJump points the jump at the next instruction compiled.
+func (c *Compiler) patchJump(operand int) {
+	jump := len(c.chunk.Code) - operand - 3
+	c.chunk.Code[operand] = byte(jump >> 16)
+	c.chunk.Code[operand+1] = byte(jump >> 8)
+	c.chunk.Code[operand+2] = byte(jump)
+}
+
+func Compile(expr Expr) *Chunk {
+	compiler := &Compiler{chunk: NewChunk()}
+	compiler.compile(expr)
+	end := SpanOf(expr).End
+	compiler.chunk.Write(byte(OpReturn), end.Line, end.Column)
+	return compiler.chunk
+}
@@ -0,0 +1,510 @@
+package lox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DapServer speaks the Debug Adapter Protocol, so editors can run a Lox
+// program under the same hooks as the Debugger. Requests are read on one
+// goroutine while the program runs on another, and a stopped program waits
+// for the next continue or step request.
+type DapServer struct {
+	stepper
+	in  *bufio.Reader
+	out io.Writer
+
+	writeMu sync.Mutex
+	seq     int
+
+	mu          sync.Mutex
+	lox         *Lox
+	program     string
+	source      []string
+	expr        Expr
+	launched    bool
+	configured  bool
+	started     bool
+	stopOnEntry bool
+	stopped     bool
+	pause       bool
+	quit        bool
+	frames      []Expr
+	values      [][]Value
+	resumes     chan int
+	done        chan struct{}
+}
+
+// The only thread a Lox program has.
+const dapThreadId = 1
+
+// Sent on resumes instead of a step mode to end the program.
+const dapQuit = -1
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+func NewDapServer(in io.Reader, out io.Writer) *DapServer {
+	return &DapServer{
+		stepper: stepper{breakpoints: map[int]bool{}},
+		in:      bufio.NewReader(in),
+		out:     out,
+		resumes: make(chan int),
+		done:    make(chan struct{}),
+	}
+}
+
+// Serve handles requests until the client disconnects or the input ends.
+func (s *DapServer) Serve() error {
+	for {
+		request, err := s.read()
+		if err == io.EOF {
+			s.stop()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		body, err := s.handle(request)
+		s.respond(request, body, err)
+
+		switch request.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "launch", "configurationDone":
+			s.start()
+		case "disconnect", "terminate":
+			return nil
+		}
+	}
+}
+
+func (s *DapServer) handle(request dapRequest) (any, error) {
+	switch request.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var args struct {
+			Program     string `json:"program"`
+			StopOnEntry bool   `json:"stopOnEntry"`
+			NoDebug     bool   `json:"noDebug"`
+		}
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args.Program, args.StopOnEntry, args.NoDebug)
+	case "setBreakpoints":
+		var args struct {
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args.Breakpoints), nil
+	case "configurationDone":
+		s.mu.Lock()
+		s.configured = true
+		s.mu.Unlock()
+		return nil, nil
+	case "threads":
+		return map[string]any{
+			"threads": []map[string]any{{"id": dapThreadId, "name": "main"}},
+		}, nil
+	case "stackTrace":
+		return s.stackTrace(), nil
+	case "scopes":
+		var args struct {
+			FrameId int `json:"frameId"`
+		}
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"scopes": []map[string]any{
+				{"name": "Expression", "variablesReference": args.FrameId + 1, "expensive": false},
+			},
+		}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args.VariablesReference - 1), nil
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+		}
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		value, err := s.evaluate(args.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"result": value.String(), "variablesReference": 0}, nil
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, s.proceed(debugContinue)
+	case "next":
+		return nil, s.proceed(debugNext)
+	case "stepIn":
+		return nil, s.proceed(debugStep)
+	case "stepOut":
+		return nil, s.proceed(debugOut)
+	case "pause":
+		s.mu.Lock()
+		s.pause = true
+		s.mu.Unlock()
+		return nil, nil
+	case "disconnect", "terminate":
+		s.stop()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unsupported request '%s'.", request.Command)
+}
+
+func (s *DapServer) launch(program string, stopOnEntry bool, noDebug bool) error {
+	source, err := os.ReadFile(program)
+	if err != nil {
+		return err
+	}
+
+	lox := &Lox{
+		Mode:   ModeEvaluate,
+		Stdout: dapOutput{s, "stdout"},
+		Stderr: dapOutput{s, "stderr"},
+	}
+	expr := lox.Parse(strings.NewReader(string(source)))
+	if lox.HadError {
+		return fmt.Errorf("Could not parse %s.", program)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lox = lox
+	s.program = program
+	s.source = strings.Split(strings.TrimSuffix(string(source), "\n"), "\n")
+	s.expr = expr
+	s.launched = true
+	s.stopOnEntry = stopOnEntry
+	if noDebug {
+		s.mode = debugDetached
+	}
+	return nil
+}
+
+// The program starts once it is launched and the client is done setting
+// breakpoints, the two requests may come in either order.
+func (s *DapServer) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.launched || !s.configured || s.started {
+		return
+	}
+	s.started = true
+
+	if s.mode != debugDetached {
+		s.mode = debugContinue
+		if s.stopOnEntry {
+			s.mode = debugStep
+		}
+	}
+	go s.run()
+}
+
+func (s *DapServer) run() {
+	defer close(s.done)
+
+	interpreter := NewInterpreter(s.lox)
+	interpreter.Hook = s
+	value, err := interpreter.Evaluate(context.Background(), s.expr)
+
+	exitCode := 0
+	switch {
+	case err == errDebugQuit:
+	case err != nil:
+		s.lox.RuntimeError(err)
+		exitCode = 70
+	default:
+		fmt.Fprintln(s.lox.Stdout, value)
+	}
+
+	s.event("exited", map[string]any{"exitCode": exitCode})
+	s.event("terminated", nil)
+}
+
+// stop ends a running program and waits for it to finish.
+func (s *DapServer) stop() {
+	s.mu.Lock()
+	started := s.started
+	stopped := s.stopped
+	s.quit = true
+	s.mu.Unlock()
+
+	if !started {
+		return
+	}
+	if stopped {
+		s.resumes <- dapQuit
+	}
+	<-s.done
+}
+
+func (s *DapServer) proceed(mode int) error {
+	s.mu.Lock()
+	stopped := s.stopped
+	s.mu.Unlock()
+
+	if !stopped {
+		return errors.New("The program is not stopped.")
+	}
+	s.resumes <- mode
+	return nil
+}
+
+func (s *DapServer) BeforeEval(frames []Expr) error {
+	s.values = append(s.values[:len(frames)-1], nil)
+
+	s.mu.Lock()
+	quit := s.quit
+	reason := s.before(frames)
+	if s.pause {
+		reason = "pause"
+		s.pause = false
+	}
+	s.mu.Unlock()
+
+	if quit {
+		return errDebugQuit
+	}
+	if reason == "" {
+		return nil
+	}
+	// Stepping only reaches the outermost expression when the program starts
+	if reason == "step" && len(frames) == 1 {
+		reason = "entry"
+	}
+	return s.wait(frames, reason)
+}
+
+func (s *DapServer) AfterEval(frames []Expr, value Value) error {
+	if len(frames) > 1 {
+		s.values[len(frames)-2] = append(s.values[len(frames)-2], value)
+	}
+
+	if !s.after(frames) {
+		return nil
+	}
+	return s.wait(frames, "step")
+}
+
+// wait blocks the program until the client resumes it, the frames can be
+// inspected in the meantime.
+func (s *DapServer) wait(frames []Expr, reason string) error {
+	s.mu.Lock()
+	if s.quit {
+		s.mu.Unlock()
+		return errDebugQuit
+	}
+	s.stopped = true
+	s.frames = frames
+	s.mu.Unlock()
+
+	s.event("stopped", map[string]any{
+		"reason":            reason,
+		"threadId":          dapThreadId,
+		"allThreadsStopped": true,
+	})
+	mode := <-s.resumes
+
+	s.mu.Lock()
+	s.stopped = false
+	s.frames = nil
+	s.mu.Unlock()
+
+	if mode == dapQuit {
+		return errDebugQuit
+	}
+	s.mu.Lock()
+	s.resume(mode, frames)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *DapServer) setBreakpoints(lines []struct {
+	Line int `json:"line"`
+}) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.breakpoints)
+	breakpoints := []map[string]any{}
+	for _, breakpoint := range lines {
+		// Before launch the length of the program is not known yet
+		verified := s.source == nil || breakpoint.Line <= len(s.source)
+		if verified {
+			s.breakpoints[breakpoint.Line] = true
+		}
+		breakpoints = append(breakpoints, map[string]any{"verified": verified, "line": breakpoint.Line})
+	}
+	return map[string]any{"breakpoints": breakpoints}
+}
+
+// Frame ids count outwards from the innermost expression.
+func (s *DapServer) stackTrace() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frames := []map[string]any{}
+	for id := range s.frames {
+		expr := s.frames[len(s.frames)-1-id]
+		token := exprToken(expr)
+		frames = append(frames, map[string]any{
+			"id":     id,
+			"name":   describeExpr(expr),
+			"line":   token.Line,
+			"column": token.Column,
+			"source": map[string]any{"path": s.program},
+		})
+	}
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+// A frame shows its expression and the values of the operands evaluated so
+// far.
+func (s *DapServer) variables(frameId int) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	variables := []map[string]any{}
+	if frameId < 0 || frameId >= len(s.frames) {
+		return map[string]any{"variables": variables}
+	}
+
+	depth := len(s.frames) - 1 - frameId
+	expr := s.frames[depth]
+	variables = append(variables, map[string]any{
+		"name":               "expression",
+		"value":              NewUnparser().Unparse(expr),
+		"variablesReference": 0,
+	})
+	for i, value := range s.values[depth] {
+		variables = append(variables, map[string]any{
+			"name":               operandNames(expr)[i],
+			"value":              value.String(),
+			"variablesReference": 0,
+		})
+	}
+	return map[string]any{"variables": variables}
+}
+
+func operandNames(expr Expr) []string {
+	switch expr.(type) {
+	case Ternary:
+		return []string{"condition", "branch"}
+	case Binary:
+		return []string{"left", "right"}
+	case Unary:
+		return []string{"right"}
+	case Grouping:
+		return []string{"expression"}
+	}
+	return nil
+}
+
+func (s *DapServer) evaluate(source string) (Value, error) {
+	s.mu.Lock()
+	lox := s.lox
+	s.mu.Unlock()
+
+	if lox == nil {
+		lox = &Lox{}
+	}
+	return lox.evaluateAlone(source)
+}
+
+func (s *DapServer) read() (dapRequest, error) {
+	var request dapRequest
+	err := readMessage(s.in, &request)
+	return request, err
+}
+
+func (s *DapServer) respond(request dapRequest, body any, err error) {
+	response := dapResponse{
+		Type:       "response",
+		RequestSeq: request.Seq,
+		Success:    err == nil,
+		Command:    request.Command,
+		Body:       body,
+	}
+	if err != nil {
+		response.Message = err.Error()
+	}
+	s.write(func(seq int) any {
+		response.Seq = seq
+		return response
+	})
+}
+
+func (s *DapServer) event(event string, body any) {
+	s.write(func(seq int) any {
+		return dapEvent{seq, "event", event, body}
+	})
+}
+
+// Sequence numbers are handed out under the write lock so messages always go
+// out in order.
+func (s *DapServer) write(message func(seq int) any) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+	writeMessage(s.out, message(s.seq))
+}
+
+// dapOutput forwards what the program prints to the client as output events.
+type dapOutput struct {
+	server   *DapServer
+	category string
+}
+
+func (o dapOutput) Write(p []byte) (int, error) {
+	o.server.event("output", map[string]any{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,165 @@
+package lox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// dapClient drives a DapServer the way an editor would.
+type dapClient struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	seq    int
+	events []map[string]any
+	done   chan error
+}
+
+func newDapClient(t *testing.T) *dapClient {
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	client := &dapClient{t: t, in: requestWriter, out: bufio.NewReader(responseReader), done: make(chan error, 1)}
+	go func() {
+		err := NewDapServer(requests, responses).Serve()
+		responses.Close()
+		client.done <- err
+	}()
+	return client
+}
+
+func (c *dapClient) read() map[string]any {
+	header, err := textproto.NewReader(c.out).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("reading header: %v", err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	content := make([]byte, length)
+	_, err = io.ReadFull(c.out, content)
+	if err != nil {
+		c.t.Fatalf("reading message: %v", err)
+	}
+	var message map[string]any
+	err = json.Unmarshal(content, &message)
+	if err != nil {
+		c.t.Fatalf("decoding %s: %v", content, err)
+	}
+	return message
+}
+
+// request returns the body of the response, events that arrive first are
+// kept for expect.
+func (c *dapClient) request(command string, arguments any) map[string]any {
+	c.seq++
+	content, _ := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(content), content)
+
+	for {
+		message := c.read()
+		if message["type"] == "event" {
+			c.events = append(c.events, message)
+			continue
+		}
+		if message["request_seq"] != float64(c.seq) || message["success"] != true {
+			c.t.Fatalf("%s failed: %v", command, message)
+		}
+		body, _ := message["body"].(map[string]any)
+		return body
+	}
+}
+
+func (c *dapClient) expect(event string) map[string]any {
+	for len(c.events) == 0 {
+		c.events = append(c.events, c.read())
+	}
+	message := c.events[0]
+	c.events = c.events[1:]
+	if message["event"] != event {
+		c.t.Fatalf("got %v, want a %s event", message, event)
+	}
+	body, _ := message["body"].(map[string]any)
+	return body
+}
+
+func TestDapSession(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "test.lox")
+	os.WriteFile(program, []byte("(1 + 2) *\n  (3 - 4)\n"), 0644)
+
+	client := newDapClient(t)
+	client.request("initialize", map[string]any{"adapterID": "lox"})
+	client.expect("initialized")
+	client.request("launch", map[string]any{"program": program})
+	breakpoints := client.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": program},
+		"breakpoints": []map[string]any{{"line": 2}, {"line": 9}},
+	})["breakpoints"].([]any)
+	if breakpoints[0].(map[string]any)["verified"] != true || breakpoints[1].(map[string]any)["verified"] != false {
+		t.Errorf("got breakpoints %v, want only line 2 verified", breakpoints)
+	}
+	client.request("configurationDone", nil)
+
+	stopped := client.expect("stopped")
+	if stopped["reason"] != "breakpoint" {
+		t.Errorf("stopped for %v, want breakpoint", stopped["reason"])
+	}
+	frames := client.request("stackTrace", map[string]any{"threadId": dapThreadId})["stackFrames"].([]any)
+	if len(frames) != 2 || frames[0].(map[string]any)["name"] != "3 - 4" || frames[0].(map[string]any)["line"] != float64(2) {
+		t.Errorf("got frames %v, want (3 - 4) inside the product", frames)
+	}
+
+	scopes := client.request("scopes", map[string]any{"frameId": 1})["scopes"].([]any)
+	reference := scopes[0].(map[string]any)["variablesReference"]
+	variables := client.request("variables", map[string]any{"variablesReference": reference})["variables"].([]any)
+	if len(variables) != 2 || variables[1].(map[string]any)["name"] != "left" || variables[1].(map[string]any)["value"] != "3" {
+		t.Errorf("got variables %v, want the left operand of the product", variables)
+	}
+
+	result := client.request("evaluate", map[string]any{"expression": "\"a\" + \"b\""})["result"]
+	if result != "ab" {
+		t.Errorf("evaluate returned %v, want ab", result)
+	}
+
+	client.request("stepOut", map[string]any{"threadId": dapThreadId})
+	if stopped := client.expect("stopped"); stopped["reason"] != "step" {
+		t.Errorf("stopped for %v, want step", stopped["reason"])
+	}
+	client.request("continue", map[string]any{"threadId": dapThreadId})
+
+	if output := client.expect("output"); output["output"] != "-3\n" || output["category"] != "stdout" {
+		t.Errorf("got output %v, want -3", output)
+	}
+	if exited := client.expect("exited"); exited["exitCode"] != float64(0) {
+		t.Errorf("exited with %v, want 0", exited["exitCode"])
+	}
+	client.expect("terminated")
+
+	client.request("disconnect", nil)
+	if err := <-client.done; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
+
+func TestDapDisconnectWhileStopped(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "test.lox")
+	os.WriteFile(program, []byte("-\"a\"\n"), 0644)
+
+	client := newDapClient(t)
+	client.request("initialize", nil)
+	client.expect("initialized")
+	client.request("configurationDone", nil)
+	client.request("launch", map[string]any{"program": program, "stopOnEntry": true})
+
+	if stopped := client.expect("stopped"); stopped["reason"] != "entry" {
+		t.Errorf("stopped for %v, want entry", stopped["reason"])
+	}
+	client.request("disconnect", nil)
+	if err := <-client.done; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package lox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Debugger runs a program on the tree-walking Interpreter and stops before
+// expressions to read commands, in the spirit of gdb.
+type Debugger struct {
+	stepper
+	lox      *Lox
+	commands *bufio.Scanner
+	out      io.Writer
+	source   []string
+	watches  []string
+}
+
+// stepper decides where to stop, for the Debugger and the DAP server.
+type stepper struct {
+	breakpoints map[int]bool
+	mode        int
+	depth       int
+	line        int
+}
+
+const (
+	debugContinue = iota
+	debugStep
+	debugNext
+	debugOut
+	// The commands ran out, the program runs to the end without stopping.
+	debugDetached
+)
+
+var errDebugQuit = errors.New("quit")
+
+// Longer expressions are cut short when they are shown at a stop.
+const debugExprWidth = 60
+
+const debugHelp = `Commands:
+  break <line>    b    Stop when execution reaches line
+  delete [line]   d    Remove the breakpoint at line, or all of them
+  continue        c    Run until the next breakpoint
+  step            s    Stop at the next expression
+  next            n    Stop at the next expression that is not nested in this one
+  out             o    Stop when this expression has been evaluated
+  print [expr]    p    Print the current expression, or evaluate expr
+  watch <expr>    w    Evaluate expr at every stop
+  backtrace       bt   Print the expressions being evaluated
+  list                 Print the source around the current line
+  quit            q    Stop the program
+`
+
+func NewDebugger(lox *Lox, commands io.Reader, out io.Writer) *Debugger {
+	return &Debugger{
+		stepper:  stepper{breakpoints: map[int]bool{}},
+		lox:      lox,
+		commands: bufio.NewScanner(commands),
+		out:      out,
+	}
+}
+
+// Debug runs source under a Debugger that reads commands from commands and
+// writes what it shows to out.
+func (lox *Lox) Debug(source string, commands io.Reader, out io.Writer) {
+	NewDebugger(lox, commands, out).Run(source)
+}
+
+// Run stops before the first expression so breakpoints can be set.
+func (d *Debugger) Run(source string) {
+	d.source = strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+	expr := d.lox.Parse(strings.NewReader(source))
+	if d.lox.HadError {
+		return
+	}
+
+	interpreter := NewInterpreter(d.lox)
+	interpreter.Limits = d.lox.Limits
+	interpreter.Hook = d
+	d.mode = debugStep
+
+	value, err := interpreter.Evaluate(context.Background(), expr)
+	if err == errDebugQuit {
+		return
+	}
+	if err != nil {
+		d.lox.RuntimeError(err)
+		return
+	}
+	fmt.Fprintln(d.lox.stdout(), value)
+}
+
+// before reports why execution should stop ahead of the innermost frame,
+// or "" to keep going. Breakpoints only stop the first expression evaluated
+// on their line.
+func (s *stepper) before(frames []Expr) string {
+	line := exprToken(frames[len(frames)-1]).Line
+	newLine := line != s.line
+	s.line = line
+
+	switch {
+	case s.mode == debugDetached:
+		return ""
+	case newLine && s.breakpoints[line]:
+		return "breakpoint"
+	case s.mode == debugStep:
+		return "step"
+	case s.mode == debugNext && len(frames) <= s.depth:
+		return "step"
+	}
+	return ""
+}
+
+// after reports whether execution should stop once the innermost frame has
+// been evaluated.
+func (s *stepper) after(frames []Expr) bool {
+	return s.mode == debugOut && len(frames) == s.depth
+}
+
+func (s *stepper) resume(mode int, frames []Expr) {
+	s.mode = mode
+	s.depth = len(frames)
+}
+
+func (d *Debugger) BeforeEval(frames []Expr) error {
+	if d.before(frames) == "" {
+		return nil
+	}
+
+	expr := frames[len(frames)-1]
+	fmt.Fprintf(d.out, "Stopped at line %d: %s\n", d.line, describeExpr(expr))
+	return d.prompt(frames)
+}
+
+func (d *Debugger) AfterEval(frames []Expr, value Value) error {
+	if !d.after(frames) {
+		return nil
+	}
+
+	expr := frames[len(frames)-1]
+	fmt.Fprintf(d.out, "Finished line %d: %s\nValue: %s\n", exprToken(expr).Line, describeExpr(expr), value)
+	return d.prompt(frames)
+}
+
+func (d *Debugger) prompt(frames []Expr) error {
+	for _, watch := range d.watches {
+		d.evaluate(watch)
+	}
+
+	for {
+		fmt.Fprint(d.out, "(debug) ")
+		if !d.commands.Scan() {
+			fmt.Fprintln(d.out)
+			d.mode = debugDetached
+			return nil
+		}
+
+		command, arg, _ := strings.Cut(strings.TrimSpace(d.commands.Text()), " ")
+		arg = strings.TrimSpace(arg)
+
+		switch command {
+		case "":
+		case "c", "continue":
+			d.resume(debugContinue, frames)
+			return nil
+		case "s", "step":
+			d.resume(debugStep, frames)
+			return nil
+		case "n", "next":
+			d.resume(debugNext, frames)
+			return nil
+		case "o", "out":
+			d.resume(debugOut, frames)
+			return nil
+		case "b", "break":
+			line, ok := d.parseLine(arg)
+			if !ok {
+				fmt.Fprintf(d.out, "Usage: break <line>, the program has %d lines.\n", len(d.source))
+				continue
+			}
+			d.breakpoints[line] = true
+			fmt.Fprintf(d.out, "Breakpoint at line %d.\n", line)
+		case "d", "delete":
+			if arg == "" {
+				clear(d.breakpoints)
+				fmt.Fprintln(d.out, "Deleted all breakpoints.")
+				continue
+			}
+			line, ok := d.parseLine(arg)
+			if !ok || !d.breakpoints[line] {
+				fmt.Fprintf(d.out, "No breakpoint at line %s.\n", arg)
+				continue
+			}
+			delete(d.breakpoints, line)
+			fmt.Fprintf(d.out, "Deleted breakpoint at line %d.\n", line)
+		case "p", "print":
+			if arg == "" {
+				fmt.Fprintln(d.out, NewUnparser().Unparse(frames[len(frames)-1]))
+				continue
+			}
+			d.evaluate(arg)
+		case "w", "watch":
+			if arg == "" {
+				fmt.Fprintln(d.out, "Usage: watch <expr>")
+				continue
+			}
+			d.watches = append(d.watches, arg)
+			d.evaluate(arg)
+		case "bt", "backtrace":
+			for i := len(frames) - 1; i >= 0; i-- {
+				expr := frames[i]
+				fmt.Fprintf(d.out, "#%d line %d: %s\n", len(frames)-1-i, exprToken(expr).Line, describeExpr(expr))
+			}
+		case "list":
+			d.list()
+		case "h", "help":
+			fmt.Fprint(d.out, debugHelp)
+		case "q", "quit":
+			return errDebugQuit
+		default:
+			fmt.Fprintf(d.out, "Unknown command %q, try help.\n", command)
+		}
+	}
+}
+
+func (d *Debugger) parseLine(arg string) (int, bool) {
+	line, err := strconv.Atoi(arg)
+	return line, err == nil && line >= 1 && line <= len(d.source)
+}
+
+func (d *Debugger) evaluate(source string) {
+	result, err := d.lox.evaluateAlone(source)
+	if err != nil {
+		fmt.Fprintf(d.out, "%s: %v\n", source, err)
+		return
+	}
+	fmt.Fprintf(d.out, "%s = %s\n", source, result)
+}
+
+// evaluateAlone runs a watch or print expression on a Lox of its own, so its
+// errors do not count against the program being debugged.
+func (lox *Lox) evaluateAlone(source string) (Value, error) {
+	var stderr strings.Builder
+	alone := &Lox{Mode: ModeEvaluate, Stdout: io.Discard, Stderr: &stderr, strings: lox.strings}
+	expr := alone.Parse(strings.NewReader(source))
+	if alone.HadError {
+		return Value{}, errors.New(strings.TrimSpace(stderr.String()))
+	}
+	return NewInterpreter(alone).Evaluate(context.Background(), expr)
+}
+
+func (d *Debugger) list() {
+	first := max(d.line-3, 1)
+	last := min(d.line+3, len(d.source))
+	for line := first; line <= last; line++ {
+		marker := "  "
+		if line == d.line {
+			marker = "->"
+		} else if d.breakpoints[line] {
+			marker = " *"
+		}
+		fmt.Fprintf(d.out, "%s %4d  %s\n", marker, line, d.source[line-1])
+	}
+}
+
+func describeExpr(expr Expr) string {
+	source := NewUnparser().Unparse(expr)
+	if len(source) > debugExprWidth {
+		return source[:debugExprWidth-3] + "..."
+	}
+	return source
+}
@@ -0,0 +1,58 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+)
+
+var opCodeNames = [...]string{
+	"OP_CONSTANT", "OP_CONSTANT_LONG", "OP_NIL", "OP_TRUE", "OP_FALSE", "OP_EQUAL", "OP_NOT_EQUAL", "OP_GREATER", "OP_GREATER_EQUAL", "OP_LESS", "OP_LESS_EQUAL", "OP_ADD", "OP_SUBTRACT", "OP_MULTIPLY", "OP_DIVIDE", "OP_NOT", "OP_NEGATE", "OP_RETURN", "OP_JUMP", "OP_JUMP_IF_FALSE",
+}
+
+func (op OpCode) String() string {
+	if int(op) >= len(opCodeNames) {
+		return fmt.Sprintf("OP_UNKNOWN(%d)", byte(op))
+	}
+	return opCodeNames[op]
+}
+
+func DisassembleChunk(w io.Writer, chunk *Chunk, name string) {
+	fmt.Fprintf(w, "== %s ==\n", name)
+	for offset := 0; offset < len(chunk.Code); {
+		offset = DisassembleInstruction(w, chunk, offset)
+	}
+}
+
+// DisassembleInstruction prints the instruction at offset and returns the
+// offset of the next one.
+func DisassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	line := chunk.Line(offset)
+	if offset > 0 && line == chunk.Line(offset-1) {
+		fmt.Fprint(w, "   | ")
+	} else {
+		fmt.Fprintf(w, "%4d ", line)
+	}
+
+	op := OpCode(chunk.Code[offset])
+	switch op {
+	case OpConstant:
+		index := int(chunk.Code[offset+1])
+		constantInstruction(w, op, chunk, index)
+		return offset + 2
+	case OpConstantLong:
+		index := int(chunk.Code[offset+1])<<16 | int(chunk.Code[offset+2])<<8 | int(chunk.Code[offset+3])
+		constantInstruction(w, op, chunk, index)
+		return offset + 4
+	case OpJump, OpJumpIfFalse:
+		fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, offset+4+chunk.jumpOffset(offset))
+		return offset + 4
+	default:
+		fmt.Fprintln(w, op)
+		return offset + 1
+	}
+}
+
+func constantInstruction(w io.Writer, op OpCode, chunk *Chunk, index int) {
+	fmt.Fprintf(w, "%-16s %4d '%s'\n", op, index, chunk.Constants[index])
+}
@@ -0,0 +1,51 @@
+package lox
+
+import (
+	"strings"
+	"testing"
+)
+
+const branchingSource = "false ?\n  -1 :\n  \"a\" + \"b\""
+
+func TestDisassembleChunk(t *testing.T) {
+	want := `== code ==
+0000    1 OP_FALSE
+0001    | OP_JUMP_IF_FALSE    1 -> 12
+0005    2 OP_CONSTANT         0 '1'
+0007    | OP_NEGATE
+0008    1 OP_JUMP             8 -> 17
+0012    3 OP_CONSTANT         1 'a'
+0014    | OP_CONSTANT         2 'b'
+0016    | OP_ADD
+0017    | OP_RETURN
+`
+	var out strings.Builder
+	DisassembleChunk(&out, Compile(parseExpr(t, branchingSource)), "code")
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+// The trace shows the stack before each instruction that runs, the branch
+// that is jumped over never appears.
+func TestVMTrace(t *testing.T) {
+	want := `          
+0000    1 OP_FALSE
+          [ false ]
+0001    | OP_JUMP_IF_FALSE    1 -> 12
+          
+0012    3 OP_CONSTANT         1 'a'
+          [ a ]
+0014    | OP_CONSTANT         2 'b'
+          [ a ][ b ]
+0016    | OP_ADD
+          [ ab ]
+0017    | OP_RETURN
+`
+	var stdout, stderr strings.Builder
+	lox := &Lox{Mode: ModeInterpret, Backend: BackendVM, Trace: true, Stdout: &stdout, Stderr: &stderr}
+	lox.Run(branchingSource)
+	if stdout.String() != "ab\n" || stderr.String() != want {
+		t.Errorf("got stdout %q and trace\n%s\nwant\n%s", stdout.String(), stderr.String(), want)
+	}
+}
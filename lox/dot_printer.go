@@ -0,0 +1,60 @@
+package lox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DotPrinter renders an expression as a Graphviz digraph, children are kept
+// in source order so operator precedence reads top to bottom.
+type DotPrinter struct {
+	sb    *strings.Builder
+	nodes *int
+}
+
+func (t DotPrinter) VisitExprTernary(ternary Ternary) any {
+	return t.node("?:", "ellipse", ternary.Condition, ternary.TrueExpr, ternary.FalseExpr)
+}
+
+func (t DotPrinter) VisitExprBinary(binary Binary) any {
+	return t.node(binary.Operator.Lexeme, "ellipse", binary.Left, binary.Right)
+}
+
+func (t DotPrinter) VisitExprGrouping(grouping Grouping) any {
+	return t.node("group", "ellipse", grouping.Expression)
+}
+
+func (t DotPrinter) VisitExprLiteral(literal Literal) any {
+	return t.node(sourceLiteral(literal.Value), "box")
+}
+
+func (t DotPrinter) VisitExprUnary(unary Unary) any {
+	return t.node(unary.Operator.Lexeme, "ellipse", unary.Right)
+}
+
+func (t DotPrinter) node(label string, shape string, children ...Expr) any {
+	id := fmt.Sprintf("node%d", *t.nodes)
+	*t.nodes++
+
+	fmt.Fprintf(t.sb, "  %s [label=%q, shape=%s];\n", id, label, shape)
+	for _, child := range children {
+		childId := child.Accept(t).(string)
+		fmt.Fprintf(t.sb, "  %s -> %s;\n", id, childId)
+	}
+	return id
+}
+
+func (t DotPrinter) Print(expr Expr) string {
+	t.sb.Reset()
+	*t.nodes = 0
+
+	t.sb.WriteString("digraph ast {\n")
+	t.sb.WriteString("  ordering=out;\n")
+	expr.Accept(t)
+	t.sb.WriteString("}")
+	return t.sb.String()
+}
+
+func NewDotPrinter() DotPrinter {
+	return DotPrinter{sb: &strings.Builder{}, nodes: new(int)}
+}
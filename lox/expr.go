@@ -5,7 +5,7 @@ type Expr interface {
 }
 
 type Visitor interface {
-	// VisitExprTernary(ternary Ternary) any
+	VisitExprTernary(ternary Ternary) any
 	VisitExprBinary(binary Binary) any
 	VisitExprGrouping(grouping Grouping) any
 	VisitExprLiteral(literal Literal) any
@@ -14,13 +14,14 @@ type Visitor interface {
 
 type Ternary struct {
 	Condition Expr
+	Question  Token
 	TrueExpr  Expr
 	FalseExpr Expr
 }
 
-// func (t Ternary) Accept(visitor Visitor) any {
-// 	return visitor.VisitExprTernary(t)
-// }
+func (t Ternary) Accept(visitor Visitor) any {
+	return visitor.VisitExprTernary(t)
+}
 
 type Binary struct {
 	Left     Expr
@@ -33,7 +34,9 @@ func (t Binary) Accept(visitor Visitor) any {
 }
 
 type Grouping struct {
+	LeftParen  Token
 	Expression Expr
+	RightParen Token
 }
 
 func (t Grouping) Accept(visitor Visitor) any {
@@ -42,6 +45,7 @@ func (t Grouping) Accept(visitor Visitor) any {
 
 type Literal struct {
 	Value any
+	Token Token
 }
 
 func (t Literal) Accept(visitor Visitor) any {
@@ -0,0 +1,93 @@
+package lox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Formatter prints an expression back as Lox source in the canonical style
+// used by `golox fmt`.
+type Formatter struct {
+	comments []Comment
+}
+
+func (f Formatter) VisitExprTernary(ternary Ternary) any {
+	return f.print(ternary.Condition) + " ? " + f.print(ternary.TrueExpr) + " : " + f.print(ternary.FalseExpr)
+}
+
+func (f Formatter) VisitExprBinary(binary Binary) any {
+	return f.print(binary.Left) + " " + binary.Operator.Lexeme + " " + f.print(binary.Right)
+}
+
+func (f Formatter) VisitExprGrouping(grouping Grouping) any {
+	return "(" + f.print(grouping.Expression) + ")"
+}
+
+func (f Formatter) VisitExprLiteral(literal Literal) any {
+	return sourceLiteral(literal.Value)
+}
+
+func (f Formatter) VisitExprUnary(unary Unary) any {
+	return unary.Operator.Lexeme + f.print(unary.Right)
+}
+
+func (f Formatter) print(expr Expr) string {
+	return expr.Accept(f).(string)
+}
+
+// Comments before the first token or after the last one keep their own
+// lines, anything in between is moved to the end of the formatted line.
+func (f Formatter) Format(expr Expr, tokens []Token) string {
+	firstLine := tokens[0].Line
+	lastLine := tokens[len(tokens)-1].Line
+	if len(tokens) > 1 {
+		lastLine = tokens[len(tokens)-2].Line
+	}
+
+	var sb strings.Builder
+	var inline []string
+	var trailing []string
+	for _, comment := range f.comments {
+		switch {
+		case comment.Line < firstLine:
+			sb.WriteString(comment.Text)
+			sb.WriteString("\n")
+		case comment.Line <= lastLine:
+			inline = append(inline, comment.Text)
+		default:
+			trailing = append(trailing, comment.Text)
+		}
+	}
+
+	sb.WriteString(f.print(expr))
+	for _, comment := range inline {
+		sb.WriteString(" ")
+		sb.WriteString(comment)
+	}
+	sb.WriteString("\n")
+
+	for _, comment := range trailing {
+		sb.WriteString(comment)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func NewFormatter(comments []Comment) Formatter {
+	return Formatter{comments: comments}
+}
+
+// Numbers are written without an exponent so the result always scans again.
+func sourceLiteral(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return "\"" + v + "\""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,51 @@
+package lox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		source    string
+		formatted string
+	}{
+		{"1+2*3", "1 + 2 * 3\n"},
+		{"!  (-1)==nil", "!(-1) == nil\n"},
+		{"true?1:2", "true ? 1 : 2\n"},
+		{"1.50 + \"a\"", "1.5 + \"a\"\n"},
+		{"// head\n\n1 +   // mid\n  2\n// tail\n", "// head\n1 + 2 // mid\n// tail\n"},
+		{"1 + // one\n2 // two\n", "1 + 2 // one // two\n"},
+		{"// only before\n(1)", "// only before\n(1)\n"},
+	}
+	for _, test := range tests {
+		var stderr strings.Builder
+		lox := &Lox{Mode: ModeFormat, Stderr: &stderr}
+		formatted := lox.Format(test.source)
+		if formatted != test.formatted || stderr.Len() > 0 {
+			t.Errorf("%q: got %q %s, want %q", test.source, formatted, stderr.String(), test.formatted)
+			continue
+		}
+		if again := lox.Format(formatted); again != formatted {
+			t.Errorf("%q: formatting again gave %q", formatted, again)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		stderr string
+	}{
+		{"* 1", "[line 1] Error at '*': Expect expression.\n"},
+		{"1 2", "[line 1] Error at '2': Expect end of expression.\n"},
+		{"1 + @", "[line 1] Error: Unexpected character: @\n"},
+	}
+	for _, test := range tests {
+		var stderr strings.Builder
+		lox := &Lox{Mode: ModeFormat, Stderr: &stderr}
+		if formatted := lox.Format(test.source); formatted != "" || !lox.HadError || stderr.String() != test.stderr {
+			t.Errorf("%q: got %q and stderr %q, want %q", test.source, formatted, stderr.String(), test.stderr)
+		}
+	}
+}
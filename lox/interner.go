@@ -0,0 +1,20 @@
+package lox
+
+// Interner hands out one canonical copy of each distinct string. Interned
+// strings share their backing bytes, so comparing two of them stops at the
+// pointer check and long-lived tables do not keep duplicate copies alive.
+type Interner struct {
+	strings map[string]string
+}
+
+func NewInterner() *Interner {
+	return &Interner{strings: map[string]string{}}
+}
+
+func (in *Interner) Intern(s string) string {
+	if canonical, ok := in.strings[s]; ok {
+		return canonical
+	}
+	in.strings[s] = s
+	return s
+}
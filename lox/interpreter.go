@@ -1,9 +1,25 @@
 package lox
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 type Interpreter struct {
-	lox *Lox
+	lox     *Lox
+	Limits  Limits
+	Hook    DebugHook
+	limiter *limiter
+	depth   int
+	frames  []Expr
+}
+
+// DebugHook follows evaluation for a debugger. Both methods get the
+// expressions currently being evaluated, innermost last, and an error
+// returned from either aborts the run.
+type DebugHook interface {
+	BeforeEval(frames []Expr) error
+	AfterEval(frames []Expr, value Value) error
 }
 
 type RuntimeError struct {
@@ -19,166 +35,221 @@ func NewInterpreter(lox *Lox) *Interpreter {
 	return &Interpreter{lox: lox}
 }
 
-func (i *Interpreter) VisitExprBinary(binary Binary) any {
-	left := i.evaluate(binary.Left)
-	right := i.evaluate(binary.Right)
+func (i *Interpreter) evaluateBinary(binary Binary) (Value, error) {
+	left, err := i.evaluate(binary.Left)
+	if err != nil {
+		return Value{}, err
+	}
+	right, err := i.evaluate(binary.Right)
+	if err != nil {
+		return Value{}, err
+	}
 
 	switch binary.Operator.Type {
-	case GREATER:
-		err := i.checkNumberOperands(binary.Operator, left, right)
-		if err != nil {
-			return err
-		}
-		return left.(float64) > right.(float64)
-	case GREATER_EQUAL:
-		err := i.checkNumberOperands(binary.Operator, left, right)
-		if err != nil {
-			return err
-		}
-		return left.(float64) >= right.(float64)
-	case LESS:
-		err := i.checkNumberOperands(binary.Operator, left, right)
-		if err != nil {
-			return err
-		}
-		return left.(float64) < right.(float64)
-	case LESS_EQUAL:
-		err := i.checkNumberOperands(binary.Operator, left, right)
-		if err != nil {
-			return err
-		}
-		return left.(float64) <= right.(float64)
 	case BANG_EQUAL:
-		return !i.isEqual(left, right)
+		return BoolValue(!left.Equals(right)), nil
 	case EQUAL_EQUAL:
-		return i.isEqual(left, right)
-	case MINUS:
-		err := i.checkNumberOperands(binary.Operator, left, right)
-		if err != nil {
-			return err
-		}
-		return left.(float64) - right.(float64)
+		return BoolValue(left.Equals(right)), nil
 	case PLUS:
 		// Left and Right must be numbers
-		_, leftIsFloat := left.(float64)
-		_, rightIsFloat := right.(float64)
-		if leftIsFloat && rightIsFloat {
-			return left.(float64) + right.(float64)
+		if left.IsNumber() && right.IsNumber() {
+			return NumberValue(left.Number + right.Number), nil
 		}
 
 		// Left and Right must be strings
-		_, leftIsString := left.(string)
-		_, rightIsString := right.(string)
-		if leftIsString && rightIsString {
-			return left.(string) + right.(string)
+		if left.IsString() && right.IsString() {
+			chars := left.AsString().Chars + right.AsString().Chars
+			err := i.limiter.allocate(objStringSize+len(chars), func() Token { return binary.Operator })
+			if err != nil {
+				return Value{}, err
+			}
+			return StringValue(&ObjString{Chars: chars}), nil
 		}
 
-		return RuntimeError{binary.Operator, "Operands must be two numbers or two strings"}
+		return Value{}, RuntimeError{binary.Operator, "Operands must be two numbers or two strings"}
+	}
+
+	err = i.checkNumberOperands(binary.Operator, left, right)
+	if err != nil {
+		return Value{}, err
+	}
+
+	switch binary.Operator.Type {
+	case GREATER:
+		return BoolValue(left.Number > right.Number), nil
+	case GREATER_EQUAL:
+		return BoolValue(left.Number >= right.Number), nil
+	case LESS:
+		return BoolValue(left.Number < right.Number), nil
+	case LESS_EQUAL:
+		return BoolValue(left.Number <= right.Number), nil
+	case MINUS:
+		return NumberValue(left.Number - right.Number), nil
 	case SLASH:
-		err := i.checkNumberOperands(binary.Operator, left, right)
-		if err != nil {
-			return err
-		}
-		return left.(float64) / right.(float64)
+		return NumberValue(left.Number / right.Number), nil
 	case STAR:
-		err := i.checkNumberOperands(binary.Operator, left, right)
-		if err != nil {
-			return err
-		}
-		return left.(float64) * right.(float64)
+		return NumberValue(left.Number * right.Number), nil
 	}
 
 	// Unreachable
-	return nil
+	return NilValue(), nil
+}
+
+func (i *Interpreter) evaluateTernary(ternary Ternary) (Value, error) {
+	condition, err := i.evaluate(ternary.Condition)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if condition.IsTruthy() {
+		return i.evaluate(ternary.TrueExpr)
+	}
+	return i.evaluate(ternary.FalseExpr)
 }
 
-func (i *Interpreter) VisitExprGrouping(grouping Grouping) any {
+func (i *Interpreter) evaluateGrouping(grouping Grouping) (Value, error) {
 	return i.evaluate(grouping.Expression)
 }
 
-func (i *Interpreter) VisitExprLiteral(literal Literal) any {
-	return literal.Value
+func (i *Interpreter) evaluateLiteral(literal Literal) (Value, error) {
+	if str, ok := literal.Value.(string); ok {
+		err := i.limiter.allocate(objStringSize+len(str), func() Token { return literal.Token })
+		if err != nil {
+			return Value{}, err
+		}
+	}
+	return ValueOf(literal.Value), nil
 }
 
-func (i *Interpreter) VisitExprUnary(unary Unary) any {
-	right := i.evaluate(unary.Right)
+func (i *Interpreter) evaluateUnary(unary Unary) (Value, error) {
+	right, err := i.evaluate(unary.Right)
+	if err != nil {
+		return Value{}, err
+	}
 
 	switch unary.Operator.Type {
 	case MINUS:
 		err := i.checkNumberOperand(unary.Operator, right)
 		if err != nil {
-			return err
+			return Value{}, err
 		}
-		return -right.(float64)
+		return NumberValue(-right.Number), nil
 	case BANG:
-		return !i.isTruty(right)
+		return BoolValue(!right.IsTruthy()), nil
 	}
-	return nil
-}
 
-func (i *Interpreter) evaluate(expr Expr) any {
-	return expr.Accept(i)
+	// Unreachable
+	return NilValue(), nil
 }
 
-func (i *Interpreter) isTruty(val any) bool {
-	switch v := val.(type) {
-	case nil:
-		return false
-	case bool:
-		return v
-	default:
-		return true
+// evaluate dispatches on the node type directly rather than through Accept,
+// which would box every result in an any.
+func (i *Interpreter) evaluate(expr Expr) (Value, error) {
+	at := func() Token { return exprToken(expr) }
+	err := i.limiter.step(at)
+	if err != nil {
+		return Value{}, err
 	}
-}
 
-func (i *Interpreter) isEqual(val1, val2 any) bool {
-	if val1 == nil && val2 == nil {
-		return true
+	// Each level of nesting costs Go stack, stop well before it runs out
+	i.depth++
+	defer func() { i.depth-- }()
+	if i.depth > maxEvalDepth {
+		return Value{}, RuntimeError{at(), "Stack overflow."}
 	}
-	if val1 == nil {
-		return false
+	err = i.limiter.nest(i.depth, at)
+	if err != nil {
+		return Value{}, err
 	}
-	return val1 == val2
-}
 
-func (i *Interpreter) stringify(obj any) string {
-	if obj == nil {
-		return "nil"
+	if i.Hook == nil {
+		return i.dispatch(expr)
 	}
 
-	if val, ok := obj.(float64); ok {
-		text := FormatNumber(val)
-		if text[len(text)-2:] == ".0" {
-			return text[:len(text)-2]
-		}
-		return text
+	i.frames = append(i.frames, expr)
+	defer func() { i.frames = i.frames[:len(i.frames)-1] }()
+	err = i.Hook.BeforeEval(i.frames)
+	if err != nil {
+		return Value{}, err
+	}
+	value, err := i.dispatch(expr)
+	if err != nil {
+		return Value{}, err
 	}
+	return value, i.Hook.AfterEval(i.frames, value)
+}
 
-	return fmt.Sprintf("%v", obj)
+func (i *Interpreter) dispatch(expr Expr) (Value, error) {
+	switch e := expr.(type) {
+	case Ternary:
+		return i.evaluateTernary(e)
+	case Binary:
+		return i.evaluateBinary(e)
+	case Grouping:
+		return i.evaluateGrouping(e)
+	case Literal:
+		return i.evaluateLiteral(e)
+	case Unary:
+		return i.evaluateUnary(e)
+	default:
+		panic(fmt.Sprintf("unexpected expression %T", expr))
+	}
 }
 
-func (i *Interpreter) checkNumberOperand(operator Token, operand any) error {
-	if _, ok := operand.(float64); ok {
+func (i *Interpreter) checkNumberOperand(operator Token, operand Value) error {
+	if operand.IsNumber() {
 		return nil
 	}
 	return RuntimeError{operator, "Operand must be a number."}
 }
 
-func (i *Interpreter) checkNumberOperands(operator Token, left, right any) error {
-	_, leftIsFloat := left.(float64)
-	_, rightIsFloat := right.(float64)
-	if leftIsFloat && rightIsFloat {
+func (i *Interpreter) checkNumberOperands(operator Token, left, right Value) error {
+	if left.IsNumber() && right.IsNumber() {
 		return nil
 	}
 	return RuntimeError{operator, "Operands must be numbers."}
 }
 
+// exprToken is the token errors about expr are reported at. Unlike SpanOf it
+// does not walk the tree.
+func exprToken(expr Expr) Token {
+	switch e := expr.(type) {
+	case Ternary:
+		return e.Question
+	case Binary:
+		return e.Operator
+	case Grouping:
+		return e.LeftParen
+	case Literal:
+		return e.Token
+	case Unary:
+		return e.Operator
+	default:
+		panic(fmt.Sprintf("unexpected expression %T", expr))
+	}
+}
+
 func (i *Interpreter) Interpret(expr Expr) {
-	value := i.evaluate(expr)
-	if v, ok := value.(error); ok {
-		i.lox.RuntimeError(v.(RuntimeError))
+	i.InterpretContext(context.Background(), expr)
+}
+
+// Evaluate returns the value of expr instead of printing it, errors are left
+// to the caller to report.
+func (i *Interpreter) Evaluate(ctx context.Context, expr Expr) (Value, error) {
+	i.limiter = newLimiter(ctx, i.Limits)
+	i.depth = 0
+	i.frames = i.frames[:0]
+	return i.evaluate(expr)
+}
+
+// InterpretContext stops with an error once ctx is done or one of the
+// interpreter's Limits is exceeded.
+func (i *Interpreter) InterpretContext(ctx context.Context, expr Expr) {
+	value, err := i.Evaluate(ctx, expr)
+	if err != nil {
+		i.lox.RuntimeError(err)
 		return
 	}
 
-	fmt.Println(i.stringify(value))
+	fmt.Fprintln(i.lox.stdout(), value)
 }
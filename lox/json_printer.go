@@ -0,0 +1,68 @@
+package lox
+
+import "encoding/json"
+
+type JsonPrinter struct {
+}
+
+func (t JsonPrinter) VisitExprTernary(ternary Ternary) any {
+	condition := ternary.Condition.Accept(t).(map[string]any)
+	falseExpr := ternary.FalseExpr.Accept(t).(map[string]any)
+	return t.node("Ternary", Span{t.span(condition).Start, t.span(falseExpr).End}, map[string]any{
+		"condition": condition,
+		"trueExpr":  ternary.TrueExpr.Accept(t),
+		"falseExpr": falseExpr,
+	})
+}
+
+func (t JsonPrinter) VisitExprBinary(binary Binary) any {
+	left := binary.Left.Accept(t).(map[string]any)
+	right := binary.Right.Accept(t).(map[string]any)
+	return t.node("Binary", Span{t.span(left).Start, t.span(right).End}, map[string]any{
+		"left":     left,
+		"operator": binary.Operator.Lexeme,
+		"right":    right,
+	})
+}
+
+func (t JsonPrinter) VisitExprGrouping(grouping Grouping) any {
+	return t.node("Grouping", Span{tokenStart(grouping.LeftParen), tokenEnd(grouping.RightParen)}, map[string]any{
+		"expression": grouping.Expression.Accept(t),
+	})
+}
+
+func (t JsonPrinter) VisitExprLiteral(literal Literal) any {
+	return t.node("Literal", Span{tokenStart(literal.Token), tokenEnd(literal.Token)}, map[string]any{
+		"value": literal.Value,
+	})
+}
+
+func (t JsonPrinter) VisitExprUnary(unary Unary) any {
+	right := unary.Right.Accept(t).(map[string]any)
+	return t.node("Unary", Span{tokenStart(unary.Operator), t.span(right).End}, map[string]any{
+		"operator": unary.Operator.Lexeme,
+		"right":    right,
+	})
+}
+
+// Spans are put together from the children's, which are already printed,
+// instead of walking each subtree again.
+func (t JsonPrinter) span(node map[string]any) Span {
+	return node["span"].(Span)
+}
+
+func (t JsonPrinter) node(kind string, span Span, fields map[string]any) map[string]any {
+	fields["kind"] = kind
+	fields["span"] = span
+	return fields
+}
+
+// Print fails when the tree is nested deeper than encoding/json allows.
+func (t JsonPrinter) Print(expr Expr) (string, error) {
+	out, err := json.MarshalIndent(expr.Accept(t), "", "  ")
+	return string(out), err
+}
+
+func NewJsonPrinter() JsonPrinter {
+	return JsonPrinter{}
+}
@@ -0,0 +1,111 @@
+package lox
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Limits bound the resources a single run may use, a zero field means no
+// limit. Steps count evaluated expressions in the Interpreter and executed
+// instructions in the VM, depth is how deeply expressions nest in the
+// Interpreter and how many values the VM stack holds.
+type Limits struct {
+	MaxSteps      int
+	MaxDepth      int
+	MaxDuration   time.Duration
+	MaxAllocBytes int
+}
+
+const (
+	LimitSteps  = "steps"
+	LimitDepth  = "depth"
+	LimitTime   = "time"
+	LimitMemory = "memory"
+)
+
+// Nesting beyond this would risk overflowing the Go stack. The parser rejects
+// deeper expressions, whichever backend runs them, and the interpreter
+// reports a Lox stack overflow for any tree that gets past it.
+const maxEvalDepth = 25000
+
+// How many steps run between looks at the clock and the context.
+const limitCheckInterval = 1024
+
+// LimitExceeded aborts a run that went over one of its Limits. Limit is one
+// of the Limit constants and Token is where execution stopped.
+type LimitExceeded struct {
+	Limit  string
+	Token  Token
+	detail string
+}
+
+func (e LimitExceeded) Error() string {
+	return "Limit exceeded: " + e.detail + "."
+}
+
+// limiter keeps the counters for one run of the Interpreter or the VM.
+type limiter struct {
+	Limits
+	ctx       context.Context
+	deadline  time.Time
+	steps     int
+	allocated int
+}
+
+func newLimiter(ctx context.Context, limits Limits) *limiter {
+	l := &limiter{Limits: limits, ctx: ctx}
+	if limits.MaxDuration > 0 {
+		l.deadline = time.Now().Add(limits.MaxDuration)
+	}
+	return l
+}
+
+// The at functions are only called to report where a limit was hit, looking
+// up a position is not free in the VM.
+func (l *limiter) step(at func() Token) error {
+	l.steps++
+	if l.MaxSteps > 0 && l.steps > l.MaxSteps {
+		return l.exceeded(LimitSteps, at())
+	}
+	if l.steps%limitCheckInterval != 0 {
+		return nil
+	}
+	if !l.deadline.IsZero() && time.Now().After(l.deadline) {
+		return l.exceeded(LimitTime, at())
+	}
+	if l.ctx.Err() != nil {
+		return RuntimeError{at(), "Execution cancelled."}
+	}
+	return nil
+}
+
+func (l *limiter) nest(depth int, at func() Token) error {
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return l.exceeded(LimitDepth, at())
+	}
+	return nil
+}
+
+func (l *limiter) allocate(size int, at func() Token) error {
+	l.allocated += size
+	if l.MaxAllocBytes > 0 && l.allocated > l.MaxAllocBytes {
+		return l.exceeded(LimitMemory, at())
+	}
+	return nil
+}
+
+func (l *limiter) exceeded(limit string, token Token) LimitExceeded {
+	var detail string
+	switch limit {
+	case LimitSteps:
+		detail = fmt.Sprintf("more than %d steps", l.MaxSteps)
+	case LimitDepth:
+		detail = fmt.Sprintf("nesting deeper than %d", l.MaxDepth)
+	case LimitTime:
+		detail = fmt.Sprintf("running longer than %s", l.MaxDuration)
+	case LimitMemory:
+		detail = fmt.Sprintf("allocating more than %d bytes", l.MaxAllocBytes)
+	}
+	return LimitExceeded{limit, token, detail}
+}
@@ -1,10 +1,13 @@
 package lox
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -13,69 +16,335 @@ const (
 	ModeTokenize
 	ModeParse
 	ModeEvaluate
+	ModeDisassemble
+	ModeCompile
+	ModeFormat
+	ModeDebug
+	ModeDap
+	ModeLsp
+	ModeCheck
+	ModeVersion
 	ModeHelp
 	ModeUnknown
 )
 
+const (
+	BackendTree = "tree"
+	BackendVM   = "vm"
+)
+
+var Backends = []string{BackendTree, BackendVM}
+
+// Lox holds the options and error state of a run. A Lox must not be used
+// from more than one goroutine at a time, but separate values share no state
+// and can run in parallel.
 type Lox struct {
 	HadError        bool
 	HadRuntimeError bool
 	Mode            int
+	OutputFormat    string
+	Backend         string
+	Trace           bool
+	OptLevel        int
+	GCStress        bool
+	GCStats         bool
+	MaxHeap         int
+	Limits          Limits
+	Errors          []SyntaxError
+
+	// Source is the file being run. When it is set diagnostics show
+	// file:line:col and an excerpt of the line, to tell apart errors from
+	// several sources.
+	Source *SourceFile
+
+	// Output goes to os.Stdout and os.Stderr unless these are set.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	strings *Interner
 }
 
 func (lox *Lox) Run(source string) {
-	scanner := NewScanner(source)
-	tokens := scanner.ScanTokens(lox)
+	lox.RunReaderContext(context.Background(), strings.NewReader(source))
+}
+
+// RunContext stops evaluating with a runtime error once ctx is done.
+func (lox *Lox) RunContext(ctx context.Context, source string) {
+	lox.RunReaderContext(ctx, strings.NewReader(source))
+}
+
+func (lox *Lox) RunReader(reader io.Reader) {
+	lox.RunReaderContext(context.Background(), reader)
+}
+
+// RunReaderContext scans the input lazily, tokens are handed to the parser as
+// they are read so the source never has to be held in memory as a whole.
+func (lox *Lox) RunReaderContext(ctx context.Context, reader io.Reader) {
+	tokens := reportingSource{lox, lox.newScanner(reader)}
 
 	switch lox.Mode {
 	case ModeTokenize:
-		for _, token := range tokens {
-			fmt.Println(token)
+		printer := NewTokenPrinter(lox.stdout(), lox.OutputFormat)
+		for {
+			token, _ := tokens.Next()
+			printer.Print(token)
+			if token.Type == EOF {
+				break
+			}
 		}
+		printer.Flush()
 	case ModeParse:
-		parser := NewParser(tokens)
-		expression := parser.parse()
+		expression := lox.parseSource(tokens)
 
 		if lox.HadError {
 			return
 		}
 
-		fmt.Println(PrintAst(expression))
-	case ModeEvaluate:
-		parser := NewParser(tokens)
-		expression := parser.parse()
+		expression = lox.optimize(expression)
+
+		switch lox.OutputFormat {
+		case FormatJson:
+			out, err := NewJsonPrinter().Print(expression)
+			if err != nil {
+				lox.Error(SpanOf(expression).Start.Line, "Cannot print JSON: "+err.Error())
+				return
+			}
+			fmt.Fprintln(lox.stdout(), out)
+		case FormatDot:
+			fmt.Fprintln(lox.stdout(), NewDotPrinter().Print(expression))
+		case FormatTree:
+			fmt.Fprintln(lox.stdout(), NewTreePrinter().Print(expression))
+		case FormatRpn:
+			fmt.Fprintln(lox.stdout(), NewRPNPrinter().Print(expression))
+		case FormatSource:
+			fmt.Fprintln(lox.stdout(), NewUnparser().Unparse(expression))
+		default:
+			fmt.Fprintln(lox.stdout(), PrintAst(expression))
+		}
+	case ModeEvaluate, ModeInterpret:
+		expression := lox.parseSource(tokens)
 
 		if lox.HadError {
 			return
 		}
 
+		expression = lox.optimize(expression)
+
+		if lox.Backend == BackendVM {
+			lox.RunChunkContext(ctx, Compile(expression))
+			return
+		}
+
 		interpreter := NewInterpreter(lox)
-		interpreter.Interpret(expression)
+		interpreter.Limits = lox.Limits
+		interpreter.InterpretContext(ctx, expression)
+	case ModeDisassemble:
+		expression := lox.parseSource(tokens)
+
+		if lox.HadError {
+			return
+		}
+
+		expression = lox.optimize(expression)
+
+		DisassembleChunk(lox.stdout(), Compile(expression), "code")
+	case ModeCheck:
+		lox.parseSource(tokens)
+	}
+}
+
+func (lox *Lox) RunChunk(chunk *Chunk) {
+	lox.RunChunkContext(context.Background(), chunk)
+}
+
+func (lox *Lox) RunChunkContext(ctx context.Context, chunk *Chunk) {
+	vm := NewVM(lox)
+	if lox.Trace {
+		vm.Trace = lox.stderr()
+	}
+	vm.Heap.StressGC = lox.GCStress
+	vm.Heap.MaxBytes = lox.MaxHeap
+	vm.Limits = lox.Limits
+	vm.InterpretContext(ctx, chunk)
+	if lox.GCStats {
+		vm.Heap.PrintStats(lox.stderr())
+	}
+}
+
+// Parse reads one expression, it returns nil after reporting syntax errors.
+func (lox *Lox) Parse(reader io.Reader) Expr {
+	return lox.parseSource(reportingSource{lox, lox.newScanner(reader)})
+}
+
+func (lox *Lox) CompileReader(reader io.Reader) *Chunk {
+	expression := lox.Parse(reader)
+
+	if lox.HadError {
+		return nil
 	}
+
+	return Compile(lox.optimize(expression))
+}
+
+// Every scanner shares the interner of its Lox, so names and strings stay
+// canonical across REPL lines.
+func (lox *Lox) newScanner(reader io.Reader) *Scanner {
+	if lox.strings == nil {
+		lox.strings = NewInterner()
+	}
+	scanner := NewReaderScanner(reader)
+	scanner.Interner = lox.strings
+	scanner.File = lox.Source
+	return scanner
+}
+
+func (lox *Lox) optimize(expr Expr) Expr {
+	if lox.OptLevel > 0 {
+		return Optimize(expr)
+	}
+	return expr
+}
+
+// parseSource parses one expression and then reads the rest of the input.
+// Like when the whole source was scanned up front, lexical errors anywhere
+// are all reported and take the place of any syntax errors. Anything after
+// the expression is a syntax error too.
+func (lox *Lox) parseSource(tokens TokenSource) Expr {
+	parser := NewParserFromSource(lox, tokens)
+	parser.deferErrors = true
+	expression := parser.parse()
+	if expression != nil && !parser.isAtEnd() {
+		parser.error(parser.peek(), "Expect end of expression.")
+	}
+	for !parser.isAtEnd() {
+		parser.advance()
+	}
+
+	if lox.HadError {
+		return nil
+	}
+	for _, err := range parser.pending {
+		lox.ErrorToken(err.Token, err.Message)
+	}
+	return expression
+}
+
+// reportingSource reports scan errors to lox as they are found, the parser
+// only ever sees valid tokens.
+type reportingSource struct {
+	lox     *Lox
+	scanner *Scanner
+}
+
+func (r reportingSource) Next() (Token, error) {
+	for {
+		token, err := r.scanner.Next()
+		if scanErr, ok := err.(ScanError); ok {
+			r.lox.scanError(scanErr)
+			continue
+		}
+		if err != nil {
+			r.lox.Error(r.scanner.Line, "Error reading source: "+err.Error())
+			return r.scanner.eof(), nil
+		}
+		return token, nil
+	}
+}
+
+func (lox *Lox) Format(source string) string {
+	scanner := lox.newScanner(strings.NewReader(source))
+	tokens := scanner.ScanTokens(lox)
+
+	if lox.HadError {
+		return ""
+	}
+
+	parser := NewParser(lox, tokens)
+	expression := parser.parse()
+
+	if expression != nil && !parser.isAtEnd() {
+		lox.ErrorToken(parser.peek(), "Expect end of expression.")
+	}
+	if lox.HadError {
+		return ""
+	}
+
+	return NewFormatter(scanner.Comments).Format(expression, tokens)
+}
+
+func (lox *Lox) stdout() io.Writer {
+	if lox.Stdout == nil {
+		return os.Stdout
+	}
+	return lox.Stdout
+}
+
+func (lox *Lox) stderr() io.Writer {
+	if lox.Stderr == nil {
+		return os.Stderr
+	}
+	return lox.Stderr
+}
+
+// SyntaxError is a scan or parse error as it was reported. Scan errors only
+// have the position of their Token set.
+type SyntaxError struct {
+	Token   Token
+	Message string
 }
 
 func (lox *Lox) Error(line int, message string) {
-	lox.report(line, "", message)
+	lox.report(Token{Line: line}, "", message)
 }
 
-func (lox *Lox) report(line int, where string, message string) {
-	fmt.Fprintf(os.Stderr, "[line %d] Error%s: %s\n", line, where, message)
+func (lox *Lox) scanError(err ScanError) {
+	lox.report(Token{Line: err.Line, Column: err.Column, File: lox.Source}, "", err.Message)
+}
+
+func (lox *Lox) report(token Token, where string, message string) {
+	file := lox.file(token)
+	if file == nil {
+		fmt.Fprintf(lox.stderr(), "[line %d] Error%s: %s\n", token.Line, where, message)
+	} else {
+		fmt.Fprintf(lox.stderr(), "[%s] Error%s: %s\n%s", file.Location(token), where, message, file.Excerpt(token))
+	}
+	lox.Errors = append(lox.Errors, SyntaxError{token, message})
 	lox.HadError = true
 }
 
 func (lox *Lox) ErrorToken(token Token, message string) {
 	if token.Type == EOF {
-		lox.report(token.Line, " at end", message)
+		lox.report(token, " at end", message)
 	} else {
-		lox.report(token.Line, " at '"+token.Lexeme+"'", message)
+		lox.report(token, " at '"+token.Lexeme+"'", message)
 	}
 }
 
-func (lox *Lox) RuntimeError(err RuntimeError) {
-	// fmt.Printf("%v\n[line %d]\n", err.Message, err.Token.Line)
+func (lox *Lox) RuntimeError(err error) {
+	var token Token
+	switch e := err.(type) {
+	case RuntimeError:
+		token = e.Token
+	case LimitExceeded:
+		token = e.Token
+	}
+	if file := lox.file(token); file != nil {
+		fmt.Fprintf(lox.stderr(), "%v\n[%s]\n%s", err, file.Location(token), file.Excerpt(token))
+	} else {
+		fmt.Fprintf(lox.stderr(), "%v\n[line %d]\n", err, token.Line)
+	}
 	lox.HadRuntimeError = true
 }
 
+// Tokens made outside the scanner, like the VM's, only have a line and
+// belong to the source being run.
+func (lox *Lox) file(token Token) *SourceFile {
+	if token.File != nil {
+		return token.File
+	}
+	return lox.Source
+}
+
 func FormatNumber(num float64) string {
 	if math.Floor(num) == num {
 		return fmt.Sprintf("%.1f", num)
@@ -0,0 +1,161 @@
+package lox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var scripts = []struct {
+	source string
+	stdout string
+	stderr string
+}{
+	{"1 + 2 * 3", "7\n", ""},
+	{"\"con\" + \"cat\"", "concat\n", ""},
+	{"!(1 == 2) != false", "true\n", ""},
+	{"(1 + 2) / 4 >= 0.75", "true\n", ""},
+	{"-\"a\" + 1", "", "Operand must be a number.\n[line 1]\n"},
+	{"\n\"a\" < 1", "", "Operands must be numbers.\n[line 2]\n"},
+	{"(1 + 2", "", "[line 1] Error at end: Expect ')' after expression.\n"},
+	{"1 + ", "", "[line 1] Error at end: Expect expression.\n"},
+}
+
+func run(ctx context.Context, backend string, source string) (*Lox, string, string) {
+	var stdout, stderr strings.Builder
+	lox := &Lox{Mode: ModeEvaluate, Backend: backend, OptLevel: 1, Stdout: &stdout, Stderr: &stderr}
+	lox.RunContext(ctx, source)
+	return lox, stdout.String(), stderr.String()
+}
+
+func TestConcurrentRuns(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		script := scripts[i%len(scripts)]
+		backend := Backends[i%len(Backends)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, stdout, stderr := run(context.Background(), backend, script.source)
+			if stdout != script.stdout || stderr != script.stderr {
+				t.Errorf("%s with %s backend: got stdout %q stderr %q, want %q and %q",
+					script.source, backend, stdout, stderr, script.stdout, script.stderr)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestErrorsStayWithTheirLox(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		source := "1 + 1"
+		if i%2 == 0 {
+			source = "1 +"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lox, _, _ := run(context.Background(), BackendTree, source)
+			if lox.HadError != (source == "1 +") {
+				t.Errorf("%s: HadError is %v", source, lox.HadError)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCancel(t *testing.T) {
+	source := strings.Repeat("1 + ", 10000) + "1"
+	for _, backend := range Backends {
+		t.Run(backend, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			var stdout, stderr strings.Builder
+			lox := &Lox{Mode: ModeEvaluate, Backend: backend, Stdout: &stdout, Stderr: &stderr}
+			lox.RunContext(ctx, source)
+			if !lox.HadRuntimeError || !strings.HasPrefix(stderr.String(), "Execution cancelled.") {
+				t.Errorf("got stdout %q stderr %q, want the run to be cancelled", stdout.String(), stderr.String())
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		limits Limits
+		limit  string
+	}{
+		{Limits{MaxSteps: 5}, LimitSteps},
+		{Limits{MaxDepth: 3}, LimitDepth},
+		{Limits{MaxAllocBytes: 100}, LimitMemory},
+	}
+	source := "\"a\" + (\"b\" + (\"c\" + (\"d\" + \"e\")))"
+	for _, test := range tests {
+		for _, backend := range Backends {
+			t.Run(fmt.Sprintf("%s/%s", test.limit, backend), func(t *testing.T) {
+				var stderr strings.Builder
+				lox := &Lox{Mode: ModeEvaluate, Backend: backend, Limits: test.limits, Stdout: &strings.Builder{}, Stderr: &stderr}
+				lox.Run(source)
+				if !lox.HadRuntimeError || !strings.HasPrefix(stderr.String(), "Limit exceeded") {
+					t.Errorf("got %q, want the %s limit to be exceeded", stderr.String(), test.limit)
+				}
+			})
+		}
+	}
+}
+
+// Without folding the VM runs the jumps, a chunk saved and loaded again has
+// to pass verification with them.
+func TestConditional(t *testing.T) {
+	tests := []struct {
+		source string
+		stdout string
+	}{
+		{"1 < 2 ? \"yes\" : -\"no\"", "yes\n"},
+		{"nil ? -\"yes\" : \"no\"", "no\n"},
+		{"0 ? 1 : 2", "1\n"},
+		{"false ? 1 : true ? 2 : 3", "2\n"},
+		{"(false ? 1 : 2) + 3", "5\n"},
+	}
+	for _, test := range tests {
+		for _, backend := range Backends {
+			for _, optLevel := range []int{0, 1} {
+				var stdout, stderr strings.Builder
+				lox := &Lox{Mode: ModeEvaluate, Backend: backend, OptLevel: optLevel, Stdout: &stdout, Stderr: &stderr}
+				lox.Run(test.source)
+				if stdout.String() != test.stdout || stderr.Len() > 0 {
+					t.Errorf("%s with %s backend at -O%d: got stdout %q stderr %q, want %q",
+						test.source, backend, optLevel, stdout.String(), stderr.String(), test.stdout)
+				}
+			}
+		}
+
+		var file bytes.Buffer
+		err := (&Lox{}).CompileReader(strings.NewReader(test.source)).Save(&file)
+		if err == nil {
+			_, err = LoadChunk(&file)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.source, err)
+		}
+	}
+}
+
+func TestDeepExpressions(t *testing.T) {
+	sum := strings.Repeat("1 + ", maxEvalDepth) + "1"
+	negations := strings.Repeat("-", maxEvalDepth+1) + "1"
+	groups := strings.Repeat("(", maxEvalDepth+1) + "1" + strings.Repeat(")", maxEvalDepth+1)
+	for _, source := range []string{sum, negations, groups} {
+		for _, backend := range Backends {
+			lox, stdout, stderr := run(context.Background(), backend, source)
+			if !lox.HadError || stdout != "" || !strings.HasSuffix(stderr, "Expression nested too deeply.\n") {
+				t.Errorf("%.10s... with %s backend: got stdout %q stderr %q, want a syntax error", source, backend, stdout, stderr)
+			}
+		}
+	}
+}
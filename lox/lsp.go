@@ -0,0 +1,498 @@
+package lox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// LspServer speaks the Language Server Protocol. Documents are scanned and
+// parsed again on every change, which is cheap for single expressions.
+type LspServer struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*lspDocument
+	utf8      bool
+	shutdown  bool
+}
+
+type lspDocument struct {
+	lines    []string
+	tokens   []Token
+	comments []Comment
+	expr     Expr
+	errors   []SyntaxError
+	runtime  error
+}
+
+type lspMessage struct {
+	Id     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type lspResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+}
+
+type lspErrorResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Error   *lspError       `json:"error"`
+}
+
+type lspNotification struct {
+	Jsonrpc string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		Uri string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+const (
+	lspParseError     = -32700
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+)
+
+const lspCompletionKeyword = 14
+
+var semanticTokenTypes = []string{"keyword", "number", "string", "operator", "variable", "comment"}
+
+// Documents are evaluated to report runtime errors as they are typed, within
+// limits small enough to keep up with typing.
+var lspLimits = Limits{MaxSteps: 100000, MaxDuration: 100 * time.Millisecond, MaxAllocBytes: 1 << 20}
+
+func NewLspServer(in io.Reader, out io.Writer) *LspServer {
+	return &LspServer{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*lspDocument{},
+	}
+}
+
+// Serve handles messages until the client sends exit, it reports whether
+// the client asked for a shutdown first.
+func (s *LspServer) Serve() (bool, error) {
+	for {
+		var message lspMessage
+		err := readMessage(s.in, &message)
+		if err == io.EOF {
+			return false, nil
+		}
+		if errors.Is(err, errMalformedMessage) {
+			writeMessage(s.out, lspErrorResponse{"2.0", nil, &lspError{lspParseError, err.Error()}})
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if message.Method == "exit" {
+			return s.shutdown, nil
+		}
+
+		result, rpcErr := s.handle(message)
+		switch {
+		case message.Id == nil:
+		case rpcErr != nil:
+			writeMessage(s.out, lspErrorResponse{"2.0", message.Id, rpcErr})
+		default:
+			writeMessage(s.out, lspResponse{"2.0", message.Id, result})
+		}
+	}
+}
+
+func (s *LspServer) handle(message lspMessage) (any, *lspError) {
+	switch message.Method {
+	case "initialize":
+		var params struct {
+			Capabilities struct {
+				General struct {
+					PositionEncodings []string `json:"positionEncodings"`
+				} `json:"general"`
+			} `json:"capabilities"`
+		}
+		json.Unmarshal(message.Params, &params)
+		encoding := "utf-16"
+		for _, offered := range params.Capabilities.General.PositionEncodings {
+			if offered == "utf-8" {
+				encoding = offered
+				s.utf8 = true
+			}
+		}
+		return map[string]any{
+			"capabilities": map[string]any{
+				"positionEncoding":   encoding,
+				"textDocumentSync":   1,
+				"hoverProvider":      true,
+				"completionProvider": map[string]any{},
+				"semanticTokensProvider": map[string]any{
+					"legend": map[string]any{"tokenTypes": semanticTokenTypes, "tokenModifiers": []string{}},
+					"full":   true,
+				},
+			},
+			"serverInfo": map[string]any{"name": "golox"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				Uri  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &lspError{lspInvalidParams, err.Error()}
+		}
+		s.update(params.TextDocument.Uri, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				Uri string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil, &lspError{lspInvalidParams, "expected the full text of the document"}
+		}
+		// Changes are always the full text, the last one wins
+		s.update(params.TextDocument.Uri, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		return nil, nil
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument struct {
+				Uri string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &lspError{lspInvalidParams, err.Error()}
+		}
+		delete(s.documents, params.TextDocument.Uri)
+		s.notify("textDocument/publishDiagnostics", map[string]any{
+			"uri":         params.TextDocument.Uri,
+			"diagnostics": []any{},
+		})
+		return nil, nil
+	case "textDocument/semanticTokens/full":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &lspError{lspInvalidParams, err.Error()}
+		}
+		document, ok := s.documents[params.TextDocument.Uri]
+		if !ok {
+			return nil, nil
+		}
+		return map[string]any{"data": s.semanticTokens(document)}, nil
+	case "textDocument/hover":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &lspError{lspInvalidParams, err.Error()}
+		}
+		document, ok := s.documents[params.TextDocument.Uri]
+		if !ok {
+			return nil, nil
+		}
+		return s.hover(document, params.Position), nil
+	case "textDocument/completion":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &lspError{lspInvalidParams, err.Error()}
+		}
+		document, ok := s.documents[params.TextDocument.Uri]
+		if !ok {
+			return []any{}, nil
+		}
+		return s.completion(document, params.Position), nil
+	}
+
+	if message.Id == nil {
+		return nil, nil
+	}
+	return nil, &lspError{lspMethodNotFound, fmt.Sprintf("Unsupported method '%s'.", message.Method)}
+}
+
+func (s *LspServer) update(uri string, text string) {
+	document := analyze(text)
+	s.documents[uri] = document
+
+	diagnostics := []any{}
+	for _, err := range document.errors {
+		diagnostics = append(diagnostics, s.diagnostic(document, err.Token, err.Message))
+	}
+	if runtimeErr, ok := document.runtime.(RuntimeError); ok {
+		diagnostics = append(diagnostics, s.diagnostic(document, runtimeErr.Token, runtimeErr.Message))
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diagnostics})
+}
+
+func analyze(text string) *lspDocument {
+	lox := &Lox{Mode: ModeEvaluate, Stdout: io.Discard, Stderr: io.Discard}
+	scanner := lox.newScanner(strings.NewReader(text))
+	document := &lspDocument{
+		lines:  strings.Split(text, "\n"),
+		tokens: scanner.ScanTokens(lox),
+	}
+	document.comments = scanner.Comments
+
+	parser := NewParser(lox, document.tokens)
+	document.expr = parser.parse()
+	if document.expr != nil && !parser.isAtEnd() {
+		lox.ErrorToken(parser.peek(), "Expect end of expression.")
+	}
+	document.errors = lox.Errors
+
+	if !lox.HadError {
+		interpreter := NewInterpreter(lox)
+		interpreter.Limits = lspLimits
+		_, document.runtime = interpreter.Evaluate(context.Background(), document.expr)
+	}
+	return document
+}
+
+func (s *LspServer) diagnostic(document *lspDocument, token Token, message string) map[string]any {
+	start, end := tokenStart(token), tokenEnd(token)
+	// Scan errors are reported without a lexeme, mark the character at least
+	if end.Column == start.Column && end.Line == start.Line && token.Type != EOF {
+		end.Column++
+	}
+	return map[string]any{
+		"range":    map[string]any{"start": s.position(document, start), "end": s.position(document, end)},
+		"severity": 1,
+		"source":   "golox",
+		"message":  message,
+	}
+}
+
+// position converts a 1-based line and byte column to the encoding the
+// client asked for.
+func (s *LspServer) position(document *lspDocument, position Position) lspPosition {
+	line := max(position.Line-1, 0)
+	column := max(position.Column-1, 0)
+	if s.utf8 || line >= len(document.lines) {
+		return lspPosition{line, column}
+	}
+	text := document.lines[line]
+	column = min(column, len(text))
+	return lspPosition{line, len(utf16.Encode([]rune(text[:column])))}
+}
+
+// column is the inverse of position for a client position on a known line.
+func (s *LspServer) column(document *lspDocument, position lspPosition) int {
+	if s.utf8 || position.Line >= len(document.lines) {
+		return position.Character + 1
+	}
+	text := document.lines[position.Line]
+	units := 0
+	for i, r := range text {
+		if units >= position.Character {
+			return i + 1
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(text) + 1
+}
+
+func semanticTokenType(typ TokenType) int {
+	switch {
+	case typ >= AND && typ <= WHILE:
+		return 0
+	case typ == NUMBER:
+		return 1
+	case typ == STRING:
+		return 2
+	case typ == MINUS || typ == PLUS || typ == SLASH || typ == STAR || typ == QUESTION || typ == COLON || (typ >= BANG && typ <= LESS_EQUAL):
+		return 3
+	case typ == IDENTIFIER:
+		return 4
+	}
+	return -1
+}
+
+// Tokens are encoded relative to the one before them, multi-line strings
+// are split into one token per line.
+func (s *LspServer) semanticTokens(document *lspDocument) []int {
+	type span struct {
+		line, column, length, typ int
+	}
+	var spans []span
+	add := func(text string, line int, column int, typ int) {
+		for i, part := range strings.Split(text, "\n") {
+			if i > 0 {
+				column = 1
+			}
+			start := s.position(document, Position{Line: line + i, Column: column})
+			end := s.position(document, Position{Line: line + i, Column: column + len(part)})
+			if end.Character > start.Character {
+				spans = append(spans, span{start.Line, start.Character, end.Character - start.Character, typ})
+			}
+		}
+	}
+	for _, token := range document.tokens {
+		if typ := semanticTokenType(token.Type); typ >= 0 {
+			add(token.Lexeme, startLine(token), token.Column, typ)
+		}
+	}
+	for _, comment := range document.comments {
+		add(comment.Text, comment.Line, comment.Column, 5)
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].line != spans[j].line {
+			return spans[i].line < spans[j].line
+		}
+		return spans[i].column < spans[j].column
+	})
+
+	data := []int{}
+	previous := span{}
+	for _, current := range spans {
+		column := current.column
+		if current.line == previous.line {
+			column -= previous.column
+		}
+		data = append(data, current.line-previous.line, column, current.length, current.typ, 0)
+		previous = current
+	}
+	return data
+}
+
+// Hovering over an operator or literal shows the expression it belongs to
+// and, when it can be evaluated on its own, its value.
+func (s *LspServer) hover(document *lspDocument, position lspPosition) any {
+	line := position.Line + 1
+	column := s.column(document, position)
+
+	var token Token
+	found := false
+	for _, candidate := range document.tokens {
+		start, end := tokenStart(candidate), tokenEnd(candidate)
+		if candidate.Type != EOF && start.Line <= line && line <= end.Line &&
+			(start.Line < line || start.Column <= column) && (end.Line > line || column < end.Column) {
+			token, found = candidate, true
+			break
+		}
+	}
+	if !found || document.expr == nil {
+		return nil
+	}
+
+	expr := exprAt(document.expr, token)
+	if expr == nil {
+		return nil
+	}
+
+	var contents strings.Builder
+	fmt.Fprintf(&contents, "```lox\n%s\n```\n%s", NewUnparser().Unparse(expr), exprKind(expr))
+	lox := &Lox{Mode: ModeEvaluate, Stdout: io.Discard, Stderr: io.Discard}
+	interpreter := NewInterpreter(lox)
+	interpreter.Limits = lspLimits
+	value, err := interpreter.Evaluate(context.Background(), expr)
+	switch err.(type) {
+	case nil:
+		fmt.Fprintf(&contents, " evaluating to `%s`", value)
+	case RuntimeError:
+		fmt.Fprintf(&contents, " failing with \"%s\"", err)
+	}
+
+	span := SpanOf(expr)
+	return map[string]any{
+		"contents": map[string]any{"kind": "markdown", "value": contents.String()},
+		"range": map[string]any{
+			"start": s.position(document, span.Start),
+			"end":   s.position(document, span.End),
+		},
+	}
+}
+
+func (s *LspServer) completion(document *lspDocument, position lspPosition) []any {
+	if position.Line >= len(document.lines) {
+		return []any{}
+	}
+	offset := s.column(document, position) - 1
+	for _, line := range document.lines[:position.Line] {
+		offset += len(line) + 1
+	}
+
+	_, candidates := Complete(strings.Join(document.lines, "\n"), offset)
+	items := []any{}
+	for _, candidate := range candidates {
+		items = append(items, map[string]any{"label": candidate, "kind": lspCompletionKeyword})
+	}
+	return items
+}
+
+// exprAt finds the innermost expression reported at token.
+func exprAt(expr Expr, token Token) Expr {
+	if exprToken(expr).Offset == token.Offset {
+		return expr
+	}
+	switch e := expr.(type) {
+	case Ternary:
+		for _, child := range []Expr{e.Condition, e.TrueExpr, e.FalseExpr} {
+			if found := exprAt(child, token); found != nil {
+				return found
+			}
+		}
+	case Binary:
+		if found := exprAt(e.Left, token); found != nil {
+			return found
+		}
+		return exprAt(e.Right, token)
+	case Grouping:
+		if e.RightParen.Offset == token.Offset {
+			return expr
+		}
+		return exprAt(e.Expression, token)
+	case Unary:
+		return exprAt(e.Right, token)
+	}
+	return nil
+}
+
+func exprKind(expr Expr) string {
+	switch e := expr.(type) {
+	case Ternary:
+		return "Conditional expression"
+	case Binary:
+		return "Binary `" + e.Operator.Lexeme + "` expression"
+	case Grouping:
+		return "Grouping"
+	case Literal:
+		return "Literal"
+	case Unary:
+		return "Unary `" + e.Operator.Lexeme + "` expression"
+	}
+	return "Expression"
+}
+
+func (s *LspServer) notify(method string, params any) {
+	writeMessage(s.out, lspNotification{"2.0", method, params})
+}
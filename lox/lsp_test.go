@@ -0,0 +1,146 @@
+package lox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// serveLsp sends messages to a fresh server and returns everything it wrote
+// back, in order.
+func serveLsp(t *testing.T, messages ...map[string]any) []map[string]any {
+	var in, out bytes.Buffer
+	for _, message := range messages {
+		message["jsonrpc"] = "2.0"
+		content, _ := json.Marshal(message)
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	}
+
+	shutdown, err := NewLspServer(&in, &out).Serve()
+	if err != nil || !shutdown {
+		t.Fatalf("Serve returned %v, %v", shutdown, err)
+	}
+
+	var replies []map[string]any
+	reader := bufio.NewReader(&out)
+	for {
+		var reply map[string]any
+		err := readMessage(reader, &reply)
+		if err == io.EOF {
+			return replies
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, reply)
+	}
+}
+
+func lspSession(source string, requests ...map[string]any) []map[string]any {
+	messages := []map[string]any{
+		{"id": 1, "method": "initialize", "params": map[string]any{}},
+		{"method": "initialized", "params": map[string]any{}},
+		{"method": "textDocument/didOpen", "params": map[string]any{
+			"textDocument": map[string]any{"uri": "file:///test.lox", "languageId": "lox", "version": 1, "text": source},
+		}},
+	}
+	messages = append(messages, requests...)
+	return append(messages,
+		map[string]any{"id": 99, "method": "shutdown"},
+		map[string]any{"method": "exit"},
+	)
+}
+
+func TestLspDiagnostics(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+		start   []any
+	}{
+		{"1 +\n  (2", "Expect ')' after expression.", []any{1.0, 4.0}},
+		{"@1", "Unexpected character: @", []any{0.0, 0.0}},
+		{"1 2", "Expect end of expression.", []any{0.0, 2.0}},
+		{"1 +\n  -\"a\"", "Operand must be a number.", []any{1.0, 2.0}},
+	}
+	for _, test := range tests {
+		replies := serveLsp(t, lspSession(test.source)...)
+		params := replies[1]["params"].(map[string]any)
+		diagnostics := params["diagnostics"].([]any)
+		if len(diagnostics) != 1 {
+			t.Errorf("%q: got diagnostics %v, want one", test.source, diagnostics)
+			continue
+		}
+		diagnostic := diagnostics[0].(map[string]any)
+		start := diagnostic["range"].(map[string]any)["start"].(map[string]any)
+		if diagnostic["message"] != test.message || !reflect.DeepEqual([]any{start["line"], start["character"]}, test.start) {
+			t.Errorf("%q: got %v at %v, want %q at %v", test.source, diagnostic["message"], start, test.message, test.start)
+		}
+	}
+}
+
+func TestLspSemanticTokens(t *testing.T) {
+	replies := serveLsp(t, lspSession("// sum\n1 + \"two\"",
+		map[string]any{"id": 2, "method": "textDocument/semanticTokens/full", "params": map[string]any{
+			"textDocument": map[string]any{"uri": "file:///test.lox"},
+		}})...)
+	data := replies[2]["result"].(map[string]any)["data"]
+	want := []any{
+		0.0, 0.0, 6.0, 5.0, 0.0,
+		1.0, 0.0, 1.0, 1.0, 0.0,
+		0.0, 2.0, 1.0, 3.0, 0.0,
+		0.0, 2.0, 5.0, 2.0, 0.0,
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("got %v, want %v", data, want)
+	}
+}
+
+func TestLspHover(t *testing.T) {
+	replies := serveLsp(t, lspSession("1 + 2 * 3",
+		map[string]any{"id": 2, "method": "textDocument/hover", "params": map[string]any{
+			"textDocument": map[string]any{"uri": "file:///test.lox"},
+			"position":     map[string]any{"line": 0, "character": 6},
+		}})...)
+	contents := replies[2]["result"].(map[string]any)["contents"].(map[string]any)["value"]
+	want := "```lox\n2 * 3\n```\nBinary `*` expression evaluating to `6`"
+	if contents != want {
+		t.Errorf("got %q, want %q", contents, want)
+	}
+}
+
+func TestLspCompletion(t *testing.T) {
+	replies := serveLsp(t, lspSession("1 +\n  fa",
+		map[string]any{"id": 2, "method": "textDocument/completion", "params": map[string]any{
+			"textDocument": map[string]any{"uri": "file:///test.lox"},
+			"position":     map[string]any{"line": 1, "character": 4},
+		}})...)
+	items := replies[2]["result"]
+	want := []any{map[string]any{"label": "false", "kind": 14.0}}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %v, want %v", items, want)
+	}
+}
+
+func TestLspMalformedMessage(t *testing.T) {
+	var in, out bytes.Buffer
+	fmt.Fprintf(&in, "Content-Length: 5\r\n\r\n{oops")
+	for _, message := range []string{`{"jsonrpc":"2.0","id":1,"method":"shutdown"}`, `{"jsonrpc":"2.0","method":"exit"}`} {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(message), message)
+	}
+
+	shutdown, err := NewLspServer(&in, &out).Serve()
+	if err != nil || !shutdown {
+		t.Fatalf("Serve returned %v, %v", shutdown, err)
+	}
+	var reply map[string]any
+	if err := readMessage(bufio.NewReader(&out), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if code := reply["error"].(map[string]any)["code"]; reply["id"] != nil || code != -32700.0 {
+		t.Errorf("got %v, want a parse error without an id", reply)
+	}
+}
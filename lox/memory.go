@@ -0,0 +1,149 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	gcHeapGrowFactor = 2
+	gcInitialHeap    = 1024 * 1024
+)
+
+// Heap owns every object the VM allocates and reclaims them with a
+// tri-color mark and sweep collector. Objects start white, turn gray when
+// they are found reachable and black once their own references have been
+// traced; whatever is still white after tracing is freed.
+type Heap struct {
+	objects   Obj
+	strings   map[string]*ObjString
+	grayStack []Obj
+	nextGC    int
+	stats     GCStats
+
+	// StressGC collects before every allocation to flush out missing roots.
+	StressGC bool
+	// MaxBytes limits the live heap, zero means no limit.
+	MaxBytes int
+}
+
+type GCStats struct {
+	BytesAllocated int
+	BytesFreed     int
+	LiveBytes      int
+	LiveObjects    int
+	Collections    int
+}
+
+func (s GCStats) String() string {
+	return fmt.Sprintf("collections: %d, bytes allocated: %d, bytes freed: %d, live: %d bytes in %d objects",
+		s.Collections, s.BytesAllocated, s.BytesFreed, s.LiveBytes, s.LiveObjects)
+}
+
+func (h *Heap) Stats() GCStats {
+	return h.stats
+}
+
+// allocate links obj into the heap. A collection may run first, so any
+// object the caller still needs has to be reachable from markRoots.
+func (h *Heap) allocate(obj Obj, size int, markRoots func()) error {
+	if h.nextGC == 0 {
+		h.nextGC = gcInitialHeap
+	}
+	if h.StressGC || h.stats.LiveBytes+size > h.nextGC {
+		h.collect(markRoots)
+	}
+	if h.MaxBytes > 0 && h.stats.LiveBytes+size > h.MaxBytes {
+		return errors.New("Out of memory.")
+	}
+
+	header := obj.header()
+	header.size = size
+	header.next = h.objects
+	h.objects = obj
+
+	h.stats.BytesAllocated += size
+	h.stats.LiveBytes += size
+	h.stats.LiveObjects++
+	return nil
+}
+
+func (h *Heap) collect(markRoots func()) {
+	markRoots()
+	h.traceReferences()
+	h.removeWhiteStrings()
+	h.sweep()
+
+	h.nextGC = max(h.stats.LiveBytes*gcHeapGrowFactor, gcInitialHeap)
+	h.stats.Collections++
+}
+
+func (h *Heap) markValue(value Value) {
+	if value.Obj != nil {
+		h.markObject(value.Obj)
+	}
+}
+
+func (h *Heap) markObject(obj Obj) {
+	header := obj.header()
+	if header.marked {
+		return
+	}
+	header.marked = true
+	h.grayStack = append(h.grayStack, obj)
+}
+
+func (h *Heap) traceReferences() {
+	for len(h.grayStack) > 0 {
+		obj := h.grayStack[len(h.grayStack)-1]
+		h.grayStack = h.grayStack[:len(h.grayStack)-1]
+		h.blackenObject(obj)
+	}
+}
+
+// Strings are the only objects so far and hold no references, objects that
+// do must mark them here.
+func (h *Heap) blackenObject(obj Obj) {
+}
+
+// The intern table holds its strings weakly, entries for strings nothing
+// else refers to are dropped before they are swept.
+func (h *Heap) removeWhiteStrings() {
+	for chars, str := range h.strings {
+		if !str.marked {
+			delete(h.strings, chars)
+		}
+	}
+}
+
+func (h *Heap) sweep() {
+	var previous Obj
+	obj := h.objects
+	for obj != nil {
+		header := obj.header()
+		if header.marked {
+			header.marked = false
+			previous = obj
+			obj = header.next
+			continue
+		}
+
+		unreached := obj
+		obj = header.next
+		if previous == nil {
+			h.objects = obj
+		} else {
+			previous.header().next = obj
+		}
+
+		h.stats.BytesFreed += unreached.header().size
+		h.stats.LiveBytes -= unreached.header().size
+		h.stats.LiveObjects--
+		unreached.header().next = nil
+	}
+}
+
+func (h *Heap) PrintStats(w io.Writer) {
+	fmt.Fprintf(w, "[gc] %s\n", h.stats)
+}
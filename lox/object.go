@@ -0,0 +1,30 @@
+package lox
+
+import "unsafe"
+
+// Obj is a value that lives on the VM heap. Every object is linked into the
+// heap's object list so the collector can find it again when sweeping.
+type Obj interface {
+	header() *objHeader
+}
+
+type objHeader struct {
+	marked bool
+	size   int
+	next   Obj
+}
+
+func (h *objHeader) header() *objHeader {
+	return h
+}
+
+type ObjString struct {
+	objHeader
+	Chars string
+}
+
+func (s *ObjString) String() string {
+	return s.Chars
+}
+
+var objStringSize = int(unsafe.Sizeof(ObjString{}))
@@ -0,0 +1,162 @@
+package lox
+
+import (
+	"math"
+	"strings"
+)
+
+// Optimizer folds operators whose operands are all literals into a single
+// literal. Anything that would fail at runtime is left alone so the error is
+// still raised, with the same line, when the program runs.
+type Optimizer struct {
+	depth int
+}
+
+func (o Optimizer) VisitExprTernary(ternary Ternary) any {
+	condition := o.optimize(ternary.Condition)
+	trueExpr := o.optimize(ternary.TrueExpr)
+	falseExpr := o.optimize(ternary.FalseExpr)
+
+	if literal, ok := condition.(Literal); ok {
+		if ValueOf(literal.Value).IsTruthy() {
+			return trueExpr
+		}
+		return falseExpr
+	}
+	return Ternary{condition, ternary.Question, trueExpr, falseExpr}
+}
+
+func (o Optimizer) VisitExprBinary(binary Binary) any {
+	expr := Binary{o.optimize(binary.Left), binary.Operator, o.optimize(binary.Right)}
+
+	left, leftIsLiteral := expr.Left.(Literal)
+	right, rightIsLiteral := expr.Right.(Literal)
+	if !leftIsLiteral || !rightIsLiteral {
+		return expr
+	}
+
+	value, ok := foldBinary(binary.Operator.Type, left.Value, right.Value)
+	if !ok {
+		return expr
+	}
+	return foldedLiteral(value, expr)
+}
+
+func (o Optimizer) VisitExprGrouping(grouping Grouping) any {
+	expr := Grouping{grouping.LeftParen, o.optimize(grouping.Expression), grouping.RightParen}
+
+	if literal, ok := expr.Expression.(Literal); ok {
+		return foldedLiteral(literal.Value, expr)
+	}
+	return expr
+}
+
+func (o Optimizer) VisitExprLiteral(literal Literal) any {
+	return literal
+}
+
+func (o Optimizer) VisitExprUnary(unary Unary) any {
+	expr := Unary{unary.Operator, o.optimize(unary.Right)}
+
+	right, ok := expr.Right.(Literal)
+	if !ok {
+		return expr
+	}
+
+	switch unary.Operator.Type {
+	case MINUS:
+		if number, ok := right.Value.(float64); ok {
+			return foldedLiteral(-number, expr)
+		}
+	case BANG:
+		return foldedLiteral(!ValueOf(right.Value).IsTruthy(), expr)
+	}
+	return expr
+}
+
+// Subtrees nested too deeply to evaluate are left as they are, running them
+// reports the stack overflow.
+func (o Optimizer) optimize(expr Expr) Expr {
+	o.depth++
+	if o.depth > maxEvalDepth {
+		return expr
+	}
+	return expr.Accept(o).(Expr)
+}
+
+func Optimize(expr Expr) Expr {
+	return Optimizer{}.optimize(expr)
+}
+
+// foldBinary follows the rules of Interpreter.evaluateBinary and reports
+// false whenever evaluating the operator would be a runtime error. Results
+// that are not finite are not folded either since they have no literal form.
+func foldBinary(operator TokenType, left, right any) (any, bool) {
+	switch operator {
+	case BANG_EQUAL:
+		return !ValueOf(left).Equals(ValueOf(right)), true
+	case EQUAL_EQUAL:
+		return ValueOf(left).Equals(ValueOf(right)), true
+	}
+
+	leftString, leftIsString := left.(string)
+	rightString, rightIsString := right.(string)
+	if operator == PLUS && leftIsString && rightIsString {
+		return leftString + rightString, true
+	}
+
+	l, leftIsFloat := left.(float64)
+	r, rightIsFloat := right.(float64)
+	if !leftIsFloat || !rightIsFloat {
+		return nil, false
+	}
+
+	var value any
+	switch operator {
+	case GREATER:
+		value = l > r
+	case GREATER_EQUAL:
+		value = l >= r
+	case LESS:
+		value = l < r
+	case LESS_EQUAL:
+		value = l <= r
+	case MINUS:
+		value = l - r
+	case PLUS:
+		value = l + r
+	case SLASH:
+		value = l / r
+	case STAR:
+		value = l * r
+	}
+
+	if number, ok := value.(float64); ok && (math.IsInf(number, 0) || math.IsNaN(number)) {
+		return nil, false
+	}
+	return value, true
+}
+
+// The folded literal takes the place of the whole expression, its token
+// starts where the expression did.
+func foldedLiteral(value any, expr Expr) Literal {
+	start := SpanOf(expr).Start
+
+	tokenType := NIL
+	var literal any = "null"
+	switch v := value.(type) {
+	case bool:
+		tokenType = FALSE
+		if v {
+			tokenType = TRUE
+		}
+	case float64:
+		tokenType, literal = NUMBER, v
+	case string:
+		tokenType, literal = STRING, v
+	}
+
+	lexeme := sourceLiteral(value)
+	line := start.Line + strings.Count(lexeme, "\n")
+	return Literal{value, Token{tokenType, lexeme, literal, line, start.Column, start.Offset, exprToken(expr).File}}
+}
@@ -1,11 +1,9 @@
 package lox
 
-import "os"
-
 /*
-expr       → equality ;
-equality   → comparison ( ( "!=" | "==" ) comparison )* | ternary ;
-ternary    → expression "?" expression ":" expression ;
+expr       → ternary ;
+ternary    → equality ( "?" expression ":" ternary )? ;
+equality   → comparison ( ( "!=" | "==" ) comparison )* ;
 comparison → term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
 term       → factor ( ( "-" | "+" ) factor )* ;
 factor     → unary ( ( "/" | "*" ) unary )* ;
@@ -14,23 +12,82 @@ primary    → NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")";
 */
 
 type Parser struct {
-	lox     Lox
+	lox       *Lox
+	source    TokenSource
+	lookahead Token
+	last      Token
+	depth     int
+
+	// Set to hold syntax errors back in pending instead of reporting them
+	deferErrors bool
+	pending     []SyntaxError
+}
+
+type ParseError struct{}
+
+// TokenSource hands tokens to the parser one at a time, so a Scanner can be
+// read lazily instead of scanning the whole input up front.
+type TokenSource interface {
+	Next() (Token, error)
+}
+
+type tokenSlice struct {
 	tokens  []Token
 	current int
 }
 
-type ParseError struct{}
+func (t *tokenSlice) Next() (Token, error) {
+	token := t.tokens[t.current]
+	if t.current < len(t.tokens)-1 {
+		t.current++
+	}
+	return token, nil
+}
 
-func NewParser(tokens []Token) *Parser {
-	return &Parser{tokens: tokens, current: 0}
+func NewParser(lox *Lox, tokens []Token) *Parser {
+	return NewParserFromSource(lox, &tokenSlice{tokens: tokens})
 }
 
-func (p *Parser) parse() Expr {
-	return p.expression()
+func NewParserFromSource(lox *Lox, source TokenSource) *Parser {
+	p := &Parser{lox: lox, source: source}
+	p.lookahead = p.read()
+	return p
+}
+
+// parse returns nil after reporting a syntax error to lox.
+func (p *Parser) parse() (expr Expr) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(ParseError); !ok {
+				panic(r)
+			}
+			expr = nil
+		}
+	}()
+
+	expr = p.expression()
+	p.checkHeight(expr)
+	return expr
 }
 
 func (p *Parser) expression() Expr {
-	return p.equality()
+	return p.ternary()
+}
+
+func (p *Parser) ternary() Expr {
+	expr := p.equality()
+
+	if p.match(QUESTION) {
+		question := p.previous()
+		p.nest()
+		trueExpr := p.expression()
+		p.consume(COLON, "Expect ':' after then branch of conditional expression.")
+		falseExpr := p.ternary()
+		p.depth--
+		expr = Ternary{expr, question, trueExpr, falseExpr}
+	}
+
+	return expr
 }
 
 func (p *Parser) equality() Expr {
@@ -42,14 +99,6 @@ func (p *Parser) equality() Expr {
 		expr = Binary{expr, operator, right}
 	}
 
-	// if p.match(QUESTION) {
-	// 	condition := expr
-	// 	trueExpr := p.expression()
-	// 	p.consume(COLON, "Expect ':' after ternary true expression.")
-	// 	falseExpr := p.expression()
-	// 	expr = Ternary{condition, trueExpr, falseExpr}
-	// }
-
 	return expr
 }
 
@@ -73,21 +122,31 @@ func (p *Parser) check(typ TokenType) bool {
 
 func (p *Parser) advance() Token {
 	if !p.isAtEnd() {
-		p.current++
+		p.last = p.lookahead
+		p.lookahead = p.read()
 	}
 	return p.previous()
 }
 
+func (p *Parser) read() Token {
+	token, err := p.source.Next()
+	if err != nil {
+		token = Token{Type: EOF, Literal: "null", Line: p.last.Line, File: p.last.File}
+		p.error(token, err.Error())
+	}
+	return token
+}
+
 func (p *Parser) isAtEnd() bool {
 	return p.peek().Type == EOF
 }
 
 func (p *Parser) peek() Token {
-	return p.tokens[p.current]
+	return p.lookahead
 }
 
 func (p *Parser) previous() Token {
-	return p.tokens[p.current-1]
+	return p.last
 }
 
 func (p *Parser) comparison() Expr {
@@ -129,7 +188,9 @@ func (p *Parser) factor() Expr {
 func (p *Parser) unary() Expr {
 	if p.match(BANG, MINUS) {
 		operator := p.previous()
+		p.nest()
 		right := p.unary()
+		p.depth--
 		return Unary{operator, right}
 	}
 
@@ -138,40 +199,89 @@ func (p *Parser) unary() Expr {
 
 func (p *Parser) primary() Expr {
 	if p.match(FALSE) {
-		return Literal{false}
+		return Literal{false, p.previous()}
 	}
 	if p.match(TRUE) {
-		return Literal{true}
+		return Literal{true, p.previous()}
 	}
 	if p.match(NIL) {
-		return Literal{nil}
+		return Literal{nil, p.previous()}
 	}
 
 	if p.match(NUMBER, STRING) {
-		return Literal{p.previous().Literal}
+		return Literal{p.previous().Literal, p.previous()}
 	}
 
 	if p.match(LEFT_PAREN) {
+		leftParen := p.previous()
+		p.nest()
 		expr := p.expression()
-		p.consume(RIGHT_PAREN, "Expect ')' after expression.")
-		return Grouping{expr}
+		p.depth--
+		rightParen := p.consume(RIGHT_PAREN, "Expect ')' after expression.")
+		return Grouping{leftParen, expr, rightParen}
 	}
 
-	os.Exit(65)
 	panic(p.error(p.peek(), "Expect expression."))
 }
 
-func (p *Parser) consume(typ TokenType, message string) (Token, ParseError) {
+// Every level of nesting recurses through all the grammar rules, input
+// nested deeper than anything could evaluate is rejected before the Go stack
+// runs out.
+func (p *Parser) nest() {
+	p.depth++
+	if p.depth > maxEvalDepth {
+		panic(p.error(p.previous(), "Expression nested too deeply."))
+	}
+}
+
+// Chains of binary operators are parsed in a loop, so nest never sees them,
+// but the compiler, the printers and the interpreter all recurse through the
+// tree. checkHeight holds the finished tree to the same depth as nesting,
+// without recursing itself.
+func (p *Parser) checkHeight(expr Expr) {
+	type level struct {
+		expr  Expr
+		depth int
+	}
+	stack := []level{{expr, 1}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.depth > maxEvalDepth {
+			panic(p.error(exprToken(top.expr), "Expression nested too deeply."))
+		}
+
+		var children []Expr
+		switch e := top.expr.(type) {
+		case Ternary:
+			children = []Expr{e.Condition, e.TrueExpr, e.FalseExpr}
+		case Binary:
+			children = []Expr{e.Left, e.Right}
+		case Grouping:
+			children = []Expr{e.Expression}
+		case Unary:
+			children = []Expr{e.Right}
+		}
+		for _, child := range children {
+			stack = append(stack, level{child, top.depth + 1})
+		}
+	}
+}
+
+func (p *Parser) consume(typ TokenType, message string) Token {
 	if p.check(typ) {
-		return p.advance(), ParseError{}
+		return p.advance()
 	}
 
-	os.Exit(65)
-	return p.peek(), p.error(p.peek(), message)
+	panic(p.error(p.peek(), message))
 }
 
 func (p *Parser) error(token Token, message string) ParseError {
-	p.lox.ErrorToken(token, message)
+	if p.deferErrors {
+		p.pending = append(p.pending, SyntaxError{token, message})
+	} else {
+		p.lox.ErrorToken(token, message)
+	}
 	return ParseError{}
 }
 
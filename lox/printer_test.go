@@ -0,0 +1,88 @@
+package lox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJsonPrinter(t *testing.T) {
+	out, err := NewJsonPrinter().Print(parseExpr(t, "-(1) *\n  \"a\""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(out)); err != nil {
+		t.Fatal(err)
+	}
+
+	span := func(startLine, startColumn, startOffset, endLine, endColumn, endOffset int) string {
+		return fmt.Sprintf(`"span":{"start":{"line":%d,"column":%d,"offset":%d},"end":{"line":%d,"column":%d,"offset":%d}}`,
+			startLine, startColumn, startOffset, endLine, endColumn, endOffset)
+	}
+	want := `{"kind":"Binary",` +
+		`"left":{"kind":"Unary","operator":"-",` +
+		`"right":{"expression":{"kind":"Literal",` + span(1, 3, 2, 1, 4, 3) + `,"value":1},"kind":"Grouping",` + span(1, 2, 1, 1, 5, 4) + `},` +
+		span(1, 1, 0, 1, 5, 4) + `},` +
+		`"operator":"*",` +
+		`"right":{"kind":"Literal",` + span(2, 3, 9, 2, 6, 12) + `,"value":"a"},` +
+		span(1, 1, 0, 2, 6, 12) + `}`
+	if compact.String() != want {
+		t.Errorf("got  %s\nwant %s", compact.String(), want)
+	}
+}
+
+func TestJsonPrinterTooDeep(t *testing.T) {
+	expr := parseExpr(t, strings.Repeat("-", 10001)+"1")
+	if _, err := NewJsonPrinter().Print(expr); err == nil {
+		t.Error("got no error for a tree deeper than encoding/json allows")
+	}
+
+	var stdout, stderr strings.Builder
+	lox := &Lox{Mode: ModeParse, OutputFormat: FormatJson, Stdout: &stdout, Stderr: &stderr}
+	lox.Run(strings.Repeat("-", 10001) + "1")
+	if !lox.HadError || stdout.Len() > 0 || !strings.HasPrefix(stderr.String(), "[line 1] Error: Cannot print JSON: ") {
+		t.Errorf("got stdout %q stderr %q, want a JSON error", stdout.String(), stderr.String())
+	}
+}
+
+func TestDotPrinter(t *testing.T) {
+	want := `digraph ast {
+  ordering=out;
+  node0 [label="?:", shape=ellipse];
+  node1 [label="!", shape=ellipse];
+  node2 [label="nil", shape=box];
+  node1 -> node2;
+  node0 -> node1;
+  node3 [label="group", shape=ellipse];
+  node4 [label="-", shape=ellipse];
+  node5 [label="1", shape=box];
+  node4 -> node5;
+  node3 -> node4;
+  node0 -> node3;
+  node6 [label="\"b\"", shape=box];
+  node0 -> node6;
+}`
+	if out := NewDotPrinter().Print(parseExpr(t, `!nil ? (-1) : "b"`)); out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestTreePrinter(t *testing.T) {
+	want := `Binary *
+├── Unary -
+│   └── Grouping
+│       └── Binary +
+│           ├── Literal 1
+│           └── Literal 2.5
+└── Grouping
+    └── Ternary
+        ├── Literal true
+        ├── Literal "a"
+        └── Literal nil`
+	if out := NewTreePrinter().Print(parseExpr(t, `-(1 + 2.5) * (true ? "a" : nil)`)); out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+}
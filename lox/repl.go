@@ -0,0 +1,76 @@
+package lox
+
+import (
+	"sort"
+	"strings"
+)
+
+// IsComplete reports whether source can be run as it is, or whether a REPL
+// should keep reading because a bracket or a string is still open.
+func IsComplete(source string) bool {
+	scanner := NewScanner(source)
+	depth := 0
+	for {
+		token, err := scanner.Next()
+		if scanErr, ok := err.(ScanError); ok {
+			if scanErr.Message == "Unterminated string." {
+				return false
+			}
+			continue
+		}
+
+		switch token.Type {
+		case LEFT_PAREN, LEFT_BRACE:
+			depth++
+		case RIGHT_PAREN, RIGHT_BRACE:
+			depth--
+		case EOF:
+			return depth <= 0
+		}
+	}
+}
+
+// Complete returns the words that can replace the one ending at cursor, a
+// byte offset into input, along with the offset where that word starts.
+// The candidates are the keywords, nothing is offered inside a string, a
+// comment or a number, or after a dot.
+func Complete(input string, cursor int) (int, []string) {
+	cursor = min(max(cursor, 0), len(input))
+	if insideLiteral(input[:cursor]) {
+		return cursor, nil
+	}
+
+	start := cursor
+	for start > 0 && isAlphaNumeric(input[start-1]) {
+		start--
+	}
+	word := input[start:cursor]
+	if word != "" && isDigit(word[0]) || start > 0 && input[start-1] == '.' {
+		return cursor, nil
+	}
+
+	var candidates []string
+	for keyword := range keywords {
+		if strings.HasPrefix(keyword, word) {
+			candidates = append(candidates, keyword)
+		}
+	}
+	sort.Strings(candidates)
+	return start, candidates
+}
+
+// insideLiteral reports whether source ends inside a string or a comment.
+func insideLiteral(source string) bool {
+	inString, inComment := false, false
+	for i := 0; i < len(source); i++ {
+		switch {
+		case inComment:
+			inComment = source[i] != '\n'
+		case source[i] == '"':
+			inString = !inString
+		case !inString && strings.HasPrefix(source[i:], "//"):
+			inComment = true
+		}
+	}
+	return inString || inComment
+}
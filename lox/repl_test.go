@@ -0,0 +1,37 @@
+package lox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		input      string
+		cursor     int
+		start      int
+		candidates []string
+	}{
+		{"tr", 2, 0, []string{"true"}},
+		{"1 + f", 5, 4, []string{"false", "for", "fun"}},
+		{"fa == nil", 2, 0, []string{"false"}},
+		{"!(n", 3, 2, []string{"nil"}},
+		{"s", 1, 0, []string{"super"}},
+		{"xyz", 3, 0, nil},
+		{"\"tr", 3, 3, nil},
+		{"1 // tr", 7, 7, nil},
+		{"1 // a\ntr", 9, 7, []string{"true"}},
+		{"a.tr", 4, 4, nil},
+		{"1t", 2, 2, nil},
+	}
+	for _, test := range tests {
+		start, candidates := Complete(test.input, test.cursor)
+		if start != test.start || !reflect.DeepEqual(candidates, test.candidates) {
+			t.Errorf("Complete(%q, %d) = %d, %v, want %d, %v", test.input, test.cursor, start, candidates, test.start, test.candidates)
+		}
+	}
+
+	if _, candidates := Complete("", 0); len(candidates) != len(keywords) {
+		t.Errorf("got %v for an empty word, want every keyword", candidates)
+	}
+}
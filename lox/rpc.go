@@ -0,0 +1,59 @@
+package lox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// The debug adapter and language server protocols both frame their JSON
+// messages with a Content-Length header.
+
+// Far more than any client sends, but small enough that a bad header cannot
+// exhaust memory.
+const maxMessageSize = 64 << 20
+
+// A message that was framed correctly but could not be decoded, the next one
+// can still be read.
+var errMalformedMessage = errors.New("malformed message")
+
+func readMessage(in *bufio.Reader, message any) error {
+	header, err := textproto.NewReader(in).ReadMIMEHeader()
+	if err != nil {
+		return err
+	}
+	value := header.Get("Content-Length")
+	if value == "" {
+		return errors.New("missing Content-Length")
+	}
+	length, err := strconv.Atoi(value)
+	if err != nil || length < 0 {
+		return fmt.Errorf("bad Content-Length %q", value)
+	}
+	if length > maxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds the limit of %d", length, maxMessageSize)
+	}
+
+	content := make([]byte, length)
+	_, err = io.ReadFull(in, content)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, message); err != nil {
+		return fmt.Errorf("%w: %v", errMalformedMessage, err)
+	}
+	return nil
+}
+
+func writeMessage(out io.Writer, message any) error {
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
@@ -0,0 +1,28 @@
+package lox
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReadMessageHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"Content-Type: application/json\r\n", "missing Content-Length"},
+		{"Content-Length: -1\r\n", `bad Content-Length "-1"`},
+		{"Content-Length: ten\r\n", `bad Content-Length "ten"`},
+		{fmt.Sprintf("Content-Length: %d\r\n", maxMessageSize+1), "exceeds the limit"},
+		{"Content-Length: 99999999999999999999\r\n", "bad Content-Length"},
+	}
+	for _, test := range tests {
+		var message map[string]any
+		err := readMessage(bufio.NewReader(strings.NewReader(test.header+"\r\n{}")), &message)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: got error %v, want %q", test.header, err, test.want)
+		}
+	}
+}
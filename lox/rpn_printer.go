@@ -0,0 +1,50 @@
+package lox
+
+import "strings"
+
+// RPNPrinter prints an expression in reverse Polish notation. Groupings
+// disappear since the order of the operators already encodes them, and
+// negation is written as "neg" to tell it apart from subtraction.
+type RPNPrinter struct {
+}
+
+func (t RPNPrinter) VisitExprTernary(ternary Ternary) any {
+	return t.postfix("?:", ternary.Condition, ternary.TrueExpr, ternary.FalseExpr)
+}
+
+func (t RPNPrinter) VisitExprBinary(binary Binary) any {
+	return t.postfix(binary.Operator.Lexeme, binary.Left, binary.Right)
+}
+
+func (t RPNPrinter) VisitExprGrouping(grouping Grouping) any {
+	return grouping.Expression.Accept(t)
+}
+
+func (t RPNPrinter) VisitExprLiteral(literal Literal) any {
+	return sourceLiteral(literal.Value)
+}
+
+func (t RPNPrinter) VisitExprUnary(unary Unary) any {
+	if unary.Operator.Type == MINUS {
+		return t.postfix("neg", unary.Right)
+	}
+	return t.postfix(unary.Operator.Lexeme, unary.Right)
+}
+
+func (t RPNPrinter) postfix(name string, exprs ...Expr) string {
+	var sb strings.Builder
+	for _, expr := range exprs {
+		sb.WriteString(expr.Accept(t).(string))
+		sb.WriteString(" ")
+	}
+	sb.WriteString(name)
+	return sb.String()
+}
+
+func (t RPNPrinter) Print(expr Expr) string {
+	return expr.Accept(t).(string)
+}
+
+func NewRPNPrinter() RPNPrinter {
+	return RPNPrinter{}
+}
@@ -1,36 +1,117 @@
 package lox
 
-import "strconv"
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
 
 type Scanner struct {
-	Source  string
-	Tokens  []Token
-	Start   int
-	Current int
+	Tokens   []Token
+	Comments []Comment
+	Start    int
+	Current  int
+	Line     int
+	Column   int
+	Interner *Interner
+	File     *SourceFile
+
+	reader      *bufio.Reader
+	lexeme      []byte
+	startColumn int
+	token       Token
+	scanned     bool
+	err         error
+	readErr     error
+}
+
+type Comment struct {
+	Text   string
+	Line   int
+	Column int
+}
+
+type ScanError struct {
 	Line    int
+	Column  int
+	Message string
+}
+
+func (e ScanError) Error() string {
+	return e.Message
 }
 
 func NewScanner(source string) *Scanner {
+	return NewReaderScanner(strings.NewReader(source))
+}
+
+func NewReaderScanner(reader io.Reader) *Scanner {
 	return &Scanner{
-		Source:  source,
-		Tokens:  []Token{},
-		Start:   0,
-		Current: 0,
-		Line:    1,
+		Tokens:   []Token{},
+		Comments: []Comment{},
+		Start:    0,
+		Current:  0,
+		Line:     1,
+		Column:   1,
+		Interner: NewInterner(),
+		reader:   bufio.NewReader(reader),
 	}
 }
 
 func (s *Scanner) ScanTokens(lox *Lox) []Token {
+	for {
+		token, err := s.Next()
+		if scanErr, ok := err.(ScanError); ok {
+			lox.scanError(scanErr)
+			continue
+		}
+		if err != nil {
+			lox.Error(s.Line, "Error reading source: "+err.Error())
+			token = s.eof()
+		}
+
+		s.Tokens = append(s.Tokens, token)
+		if token.Type == EOF {
+			return s.Tokens
+		}
+	}
+}
+
+// Next scans and returns the next token. Lexical errors are returned as a
+// ScanError and scanning can continue with the following call, once the
+// input is exhausted every call returns an EOF token.
+func (s *Scanner) Next() (Token, error) {
 	for !s.isAtEnd() {
 		s.Start = s.Current
-		s.scanToken(lox)
+		s.startColumn = s.Column
+		s.lexeme = s.lexeme[:0]
+		s.scanToken()
+
+		if s.err != nil {
+			err := s.err
+			s.err = nil
+			return Token{}, err
+		}
+		if s.scanned {
+			s.scanned = false
+			return s.token, nil
+		}
 	}
 
-	s.Tokens = append(s.Tokens, Token{EOF, "", "null", s.Line})
-	return s.Tokens
+	if s.readErr != nil {
+		err := s.readErr
+		s.readErr = nil
+		return Token{}, err
+	}
+	return s.eof(), nil
 }
 
-func (s *Scanner) scanToken(lox *Lox) {
+func (s *Scanner) eof() Token {
+	return Token{EOF, "", "null", s.Line, s.Column, s.Current, s.File}
+}
+
+func (s *Scanner) scanToken() {
 	c := s.advance()
 
 	switch c {
@@ -83,9 +164,21 @@ func (s *Scanner) scanToken(lox *Lox) {
 			for s.peek() != '\n' && !s.isAtEnd() {
 				s.advance()
 			}
+			s.Comments = append(s.Comments, Comment{string(s.lexeme), s.Line, s.startColumn})
 		} else {
 			s.addToken(SLASH)
 		}
+	case '#':
+		// A #! line at the very start lets scripts be run directly, it is
+		// kept as a comment so formatting preserves it
+		if s.Start == 0 && s.match('!') {
+			for s.peek() != '\n' && !s.isAtEnd() {
+				s.advance()
+			}
+			s.Comments = append(s.Comments, Comment{string(s.lexeme), s.Line, s.startColumn})
+		} else {
+			s.error("Unexpected character: " + string(c))
+		}
 	case '?':
 		s.addToken(QUESTION)
 	case ':':
@@ -95,14 +188,14 @@ func (s *Scanner) scanToken(lox *Lox) {
 	case '\n':
 		s.Line++
 	case '"':
-		s.string(lox)
+		s.string()
 	default:
 		if isDigit(c) {
 			s.number()
 		} else if isAlpha(c) {
 			s.identifier()
 		} else {
-			lox.Error(s.Line, "Unexpected character: "+string(c))
+			s.error("Unexpected character: " + string(c))
 		}
 	}
 }
@@ -111,19 +204,27 @@ func (s *Scanner) peek() byte {
 	if s.isAtEnd() {
 		return '\000'
 	}
-	return s.Source[s.Current]
+	b, _ := s.reader.Peek(1)
+	return b[0]
 }
 
 func (s *Scanner) peekNext() byte {
-	if s.Current+1 >= len(s.Source) {
+	b, _ := s.reader.Peek(2)
+	if len(b) < 2 {
 		return '\000'
 	}
-	return s.Source[s.Current+1]
+	return b[1]
 }
 
 func (s *Scanner) advance() byte {
+	c, _ := s.reader.ReadByte()
 	s.Current++
-	return s.Source[s.Current-1]
+	s.Column++
+	if c == '\n' {
+		s.Column = 1
+	}
+	s.lexeme = append(s.lexeme, c)
+	return c
 }
 
 func (s *Scanner) addToken(tokenType TokenType) {
@@ -131,23 +232,31 @@ func (s *Scanner) addToken(tokenType TokenType) {
 }
 
 func (s *Scanner) addTokenWithLiteral(tokenType TokenType, literal any) {
-	text := s.Source[s.Start:s.Current]
-	s.Tokens = append(s.Tokens, Token{tokenType, text, literal, s.Line})
+	text := string(s.lexeme)
+	if tokenType == IDENTIFIER {
+		text = s.Interner.Intern(text)
+	}
+	s.token = Token{tokenType, text, literal, s.Line, s.startColumn, s.Start, s.File}
+	s.scanned = true
+}
+
+func (s *Scanner) error(message string) {
+	s.err = ScanError{s.Line, s.startColumn, message}
 }
 
 func (s *Scanner) match(expected byte) bool {
 	if s.isAtEnd() {
 		return false
 	}
-	if s.Source[s.Current] != expected {
+	if s.peek() != expected {
 		return false
 	}
 
-	s.Current++
+	s.advance()
 	return true
 }
 
-func (s *Scanner) string(lox *Lox) {
+func (s *Scanner) string() {
 	for s.peek() != '"' && !s.isAtEnd() {
 		if s.peek() == '\n' {
 			s.Line++
@@ -155,8 +264,12 @@ func (s *Scanner) string(lox *Lox) {
 		s.advance()
 	}
 
+	// When reading failed the string may well have gone on, only the read
+	// error is reported.
 	if s.isAtEnd() {
-		lox.Error(s.Line, "Unterminated string.")
+		if s.readErr == nil {
+			s.error("Unterminated string.")
+		}
 		return
 	}
 
@@ -164,7 +277,7 @@ func (s *Scanner) string(lox *Lox) {
 	s.advance()
 
 	// Trim the surround quotes
-	value := s.Source[s.Start+1 : s.Current-1]
+	value := s.Interner.Intern(string(s.lexeme[1 : len(s.lexeme)-1]))
 	s.addTokenWithLiteral(STRING, value)
 }
 
@@ -182,7 +295,7 @@ func (s *Scanner) number() {
 		}
 	}
 
-	value, _ := strconv.ParseFloat(s.Source[s.Start:s.Current], 64)
+	value, _ := strconv.ParseFloat(string(s.lexeme), 64)
 	s.addTokenWithLiteral(NUMBER, value)
 }
 
@@ -191,7 +304,7 @@ func (s *Scanner) identifier() {
 		s.advance()
 	}
 
-	text := s.Source[s.Start:s.Current]
+	text := string(s.lexeme)
 	tokenType, ok := keywords[text]
 	if !ok {
 		tokenType = IDENTIFIER
@@ -200,7 +313,11 @@ func (s *Scanner) identifier() {
 }
 
 func (s *Scanner) isAtEnd() bool {
-	return s.Current >= len(s.Source)
+	_, err := s.reader.Peek(1)
+	if err != nil && err != io.EOF {
+		s.readErr = err
+	}
+	return err != nil
 }
 
 func isDigit(c byte) bool {
@@ -0,0 +1,85 @@
+package lox
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type scanned struct {
+	tokens   []Token
+	errors   []string
+	comments []Comment
+}
+
+func scanAll(scanner *Scanner) scanned {
+	var result scanned
+	for {
+		token, err := scanner.Next()
+		if err != nil {
+			result.errors = append(result.errors, err.Error())
+			if _, ok := err.(ScanError); ok {
+				continue
+			}
+			break
+		}
+		result.tokens = append(result.tokens, token)
+		if token.Type == EOF {
+			break
+		}
+	}
+	result.comments = scanner.Comments
+	return result
+}
+
+// Reading the source in small pieces must not change a single token, even
+// when a piece ends inside a string, a number or a UTF-8 sequence.
+func TestReaderScannerSplitReads(t *testing.T) {
+	// Longer than the scanner's read buffer, so every split also happens at
+	// a buffer boundary somewhere.
+	long := strings.Repeat("héllo wörld ∑ ", 400)
+	sources := []string{
+		"1 + 2.5 * (3 - \"héllo\") // ünïcode comment\n!= nil",
+		"\"" + long + "\" == \"" + long + "\"",
+		"\"multi\nline ∑\" >= 12.75\n// last",
+		"\"" + long,
+		"1 @ 2 € 3",
+		"123.456.789",
+	}
+	for _, source := range sources {
+		want := scanAll(NewScanner(source))
+		readers := map[string]io.Reader{
+			"one byte": iotest.OneByteReader(strings.NewReader(source)),
+			"half":     iotest.HalfReader(strings.NewReader(source)),
+			"data err": iotest.DataErrReader(strings.NewReader(source)),
+		}
+		for name, reader := range readers {
+			if got := scanAll(NewReaderScanner(reader)); !reflect.DeepEqual(got, want) {
+				t.Errorf("%.20q read %s at a time: got %v, want %v", source, name, got, want)
+			}
+		}
+	}
+}
+
+func TestReaderScannerLiterals(t *testing.T) {
+	long := strings.Repeat("ü∑", 3000)
+	got := scanAll(NewReaderScanner(iotest.OneByteReader(strings.NewReader("\"" + long + "\" \"é\""))))
+	if len(got.errors) > 0 || len(got.tokens) != 3 {
+		t.Fatalf("got %v", got)
+	}
+	if got.tokens[0].Literal != long || got.tokens[1].Literal != "é" || got.tokens[1].Offset != len(long)+3 {
+		t.Errorf("got strings %.10q and %q at offset %d", got.tokens[0].Literal, got.tokens[1].Literal, got.tokens[1].Offset)
+	}
+}
+
+func TestReaderScannerReadError(t *testing.T) {
+	failure := errors.New("disk on fire")
+	reader := io.MultiReader(strings.NewReader("1 + \"ab"), iotest.ErrReader(failure))
+	got := scanAll(NewReaderScanner(reader))
+	if len(got.errors) != 1 || got.errors[0] != failure.Error() {
+		t.Errorf("got tokens %v and errors %v, want the read error", got.tokens, got.errors)
+	}
+}
@@ -0,0 +1,98 @@
+package lox
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SourceFile is a source that tokens point back to. Files on disk are only
+// read again when an excerpt is needed, virtual files such as REPL entries
+// and -e snippets keep their text.
+type SourceFile struct {
+	Name    string
+	Virtual bool
+
+	lines  []string
+	loaded bool
+}
+
+// FileSet holds every source of a session, like go/token.FileSet.
+type FileSet struct {
+	Files []*SourceFile
+}
+
+func NewFileSet() *FileSet {
+	return &FileSet{Files: []*SourceFile{}}
+}
+
+func (s *FileSet) AddFile(name string) *SourceFile {
+	file := &SourceFile{Name: name}
+	s.Files = append(s.Files, file)
+	return file
+}
+
+func (s *FileSet) AddVirtual(name string, text string) *SourceFile {
+	file := &SourceFile{Name: name, Virtual: true, lines: strings.Split(text, "\n"), loaded: true}
+	s.Files = append(s.Files, file)
+	return file
+}
+
+// File returns the most recently added file called name, or nil.
+func (s *FileSet) File(name string) *SourceFile {
+	for i := len(s.Files) - 1; i >= 0; i-- {
+		if s.Files[i].Name == name {
+			return s.Files[i]
+		}
+	}
+	return nil
+}
+
+// Line returns the text of a 1-based line, and false when the line does not
+// exist or the file can no longer be read.
+func (f *SourceFile) Line(line int) (string, bool) {
+	if !f.loaded {
+		f.loaded = true
+		if contents, err := os.ReadFile(f.Name); err == nil {
+			f.lines = strings.Split(string(contents), "\n")
+		}
+	}
+	if line < 1 || line > len(f.lines) {
+		return "", false
+	}
+	return strings.TrimSuffix(f.lines[line-1], "\r"), true
+}
+
+// Location is file:line:col, or file:line for tokens without a column.
+func (f *SourceFile) Location(token Token) string {
+	if token.Column == 0 {
+		return fmt.Sprintf("%s:%d", f.Name, startLine(token))
+	}
+	return fmt.Sprintf("%s:%d:%d", f.Name, startLine(token), token.Column)
+}
+
+// Excerpt shows the line token starts on with a caret under its first
+// character, or "" when the line cannot be found.
+func (f *SourceFile) Excerpt(token Token) string {
+	line := startLine(token)
+	text, ok := f.Line(line)
+	if !ok {
+		return ""
+	}
+
+	number := fmt.Sprint(line)
+	excerpt := fmt.Sprintf(" %s | %s\n", number, text)
+	if token.Column > 0 && token.Column <= len(text)+1 {
+		// Tabs are kept so the caret lines up however wide they are shown
+		var indent strings.Builder
+		for _, r := range text[:token.Column-1] {
+			if r == '\t' {
+				indent.WriteRune('\t')
+			} else {
+				indent.WriteRune(' ')
+			}
+		}
+		excerpt += fmt.Sprintf(" %s | %s^\n", strings.Repeat(" ", len(number)), indent.String())
+	}
+	return excerpt
+}
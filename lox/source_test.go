@@ -0,0 +1,37 @@
+package lox
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSourceDiagnostics(t *testing.T) {
+	files := NewFileSet()
+	var stderr bytes.Buffer
+	lox := &Lox{Mode: ModeEvaluate, Stdout: &bytes.Buffer{}, Stderr: &stderr}
+
+	source := "1 +\n\t(2 * \"a\")"
+	lox.Source = files.AddVirtual("<repl:1>", source)
+	want := "Operands must be numbers.\n[<repl:1>:2:5]\n 2 | \t(2 * \"a\")\n   | \t   ^\n"
+	for _, backend := range Backends {
+		stderr.Reset()
+		lox.Backend = backend
+		lox.Run(source)
+		if stderr.String() != want {
+			t.Errorf("%s: got %q, want %q", backend, stderr.String(), want)
+		}
+	}
+	lox.Backend = BackendTree
+
+	stderr.Reset()
+	lox.Source = files.AddVirtual("-e", "(1")
+	lox.Run("(1")
+	want = "[-e:1:3] Error at end: Expect ')' after expression.\n 1 | (1\n   |   ^\n"
+	if stderr.String() != want {
+		t.Errorf("got %q, want %q", stderr.String(), want)
+	}
+
+	if files.File("<repl:1>") == nil || files.File("missing.lox") != nil {
+		t.Errorf("File found %v", files.Files)
+	}
+}
@@ -0,0 +1,79 @@
+package lox
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// Span covers the source of an expression, End is just past its last byte.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// SpanOf only follows the leftmost and rightmost paths down from expr, so it
+// costs the depth of the tree rather than its size.
+func SpanOf(expr Expr) Span {
+	return Span{exprStart(expr), exprEnd(expr)}
+}
+
+func exprStart(expr Expr) Position {
+	for {
+		switch e := expr.(type) {
+		case Ternary:
+			expr = e.Condition
+		case Binary:
+			expr = e.Left
+		case Grouping:
+			return tokenStart(e.LeftParen)
+		case Literal:
+			return tokenStart(e.Token)
+		case Unary:
+			return tokenStart(e.Operator)
+		default:
+			panic(fmt.Sprintf("unexpected expression %T", expr))
+		}
+	}
+}
+
+func exprEnd(expr Expr) Position {
+	for {
+		switch e := expr.(type) {
+		case Ternary:
+			expr = e.FalseExpr
+		case Binary:
+			expr = e.Right
+		case Grouping:
+			return tokenEnd(e.RightParen)
+		case Literal:
+			return tokenEnd(e.Token)
+		case Unary:
+			expr = e.Right
+		default:
+			panic(fmt.Sprintf("unexpected expression %T", expr))
+		}
+	}
+}
+
+func tokenStart(token Token) Position {
+	return Position{startLine(token), token.Column, token.Offset}
+}
+
+func tokenEnd(token Token) Position {
+	column := token.Column + len(token.Lexeme)
+	if i := strings.LastIndexByte(token.Lexeme, '\n'); i >= 0 {
+		column = len(token.Lexeme) - i
+	}
+	return Position{token.Line, column, token.Offset + len(token.Lexeme)}
+}
+
+// A token's Line is where it ends, Column and Offset are where it starts.
+func startLine(token Token) int {
+	return token.Line - strings.Count(token.Lexeme, "\n")
+}
@@ -82,6 +82,9 @@ type Token struct {
 	Lexeme  string
 	Literal any
 	Line    int
+	Column  int
+	Offset  int
+	File    *SourceFile
 }
 
 func (t Token) String() string {
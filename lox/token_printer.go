@@ -0,0 +1,100 @@
+package lox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	FormatText   = "text"
+	FormatJson   = "json"
+	FormatTable  = "table"
+	FormatSexpr  = "sexpr"
+	FormatDot    = "dot"
+	FormatTree   = "tree"
+	FormatRpn    = "rpn"
+	FormatSource = "source"
+)
+
+var TokenFormats = []string{FormatText, FormatJson, FormatTable}
+var AstFormats = []string{FormatSexpr, FormatJson, FormatDot, FormatTree, FormatRpn, FormatSource}
+
+// TokenPrinter writes the tokens produced in tokenize mode. The json format
+// writes one object per line so the output can be consumed as a stream.
+type TokenPrinter struct {
+	format  string
+	writer  io.Writer
+	encoder *json.Encoder
+	table   *tabwriter.Writer
+}
+
+type jsonToken struct {
+	Type    string `json:"type"`
+	Lexeme  string `json:"lexeme"`
+	Literal any    `json:"literal"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Offset  int    `json:"offset"`
+}
+
+func NewTokenPrinter(writer io.Writer, format string) *TokenPrinter {
+	p := &TokenPrinter{format: format, writer: writer}
+
+	switch format {
+	case FormatJson:
+		p.encoder = json.NewEncoder(writer)
+	case FormatTable:
+		p.table = tabwriter.NewWriter(writer, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(p.table, "LINE\tCOLUMN\tOFFSET\tTYPE\tLEXEME\tLITERAL")
+	}
+	return p
+}
+
+func (p *TokenPrinter) Print(token Token) {
+	switch p.format {
+	case FormatJson:
+		p.encoder.Encode(jsonToken{
+			Type:    token.Type.String(),
+			Lexeme:  token.Lexeme,
+			Literal: tokenLiteral(token),
+			Line:    startLine(token),
+			Column:  token.Column,
+			Offset:  token.Offset,
+		})
+	case FormatTable:
+		literal := ""
+		switch l := tokenLiteral(token).(type) {
+		case float64:
+			literal = FormatNumber(l)
+		case string:
+			literal = l
+		}
+		fmt.Fprintf(p.table, "%d\t%d\t%d\t%s\t%s\t%s\n",
+			startLine(token), token.Column, token.Offset, token.Type, escapeNewlines(token.Lexeme), escapeNewlines(literal))
+	default:
+		fmt.Fprintln(p.writer, token)
+	}
+}
+
+func (p *TokenPrinter) Flush() {
+	if p.table != nil {
+		p.table.Flush()
+	}
+}
+
+// Tokens without a value carry the string "null" as their literal.
+func tokenLiteral(token Token) any {
+	switch token.Type {
+	case STRING, NUMBER:
+		return token.Literal
+	default:
+		return nil
+	}
+}
+
+func escapeNewlines(text string) string {
+	return strings.ReplaceAll(text, "\n", "\\n")
+}
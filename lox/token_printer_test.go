@@ -0,0 +1,60 @@
+package lox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenFormats(t *testing.T) {
+	source := "(1 + \"é\")\n  // c\nnil"
+	tests := []struct {
+		format string
+		stdout string
+	}{
+		{FormatText, `LEFT_PAREN ( null
+NUMBER 1 1.0
+PLUS + null
+STRING "é" é
+RIGHT_PAREN ) null
+NIL nil null
+EOF  null
+`},
+		{FormatJson, `{"type":"LEFT_PAREN","lexeme":"(","literal":null,"line":1,"column":1,"offset":0}
+{"type":"NUMBER","lexeme":"1","literal":1,"line":1,"column":2,"offset":1}
+{"type":"PLUS","lexeme":"+","literal":null,"line":1,"column":4,"offset":3}
+{"type":"STRING","lexeme":"\"é\"","literal":"é","line":1,"column":6,"offset":5}
+{"type":"RIGHT_PAREN","lexeme":")","literal":null,"line":1,"column":10,"offset":9}
+{"type":"NIL","lexeme":"nil","literal":null,"line":3,"column":1,"offset":18}
+{"type":"EOF","lexeme":"","literal":null,"line":3,"column":4,"offset":21}
+`},
+		{FormatTable, "LINE  COLUMN  OFFSET  TYPE         LEXEME  LITERAL\n" +
+			"1     1       0       LEFT_PAREN   (       \n" +
+			"1     2       1       NUMBER       1       1.0\n" +
+			"1     4       3       PLUS         +       \n" +
+			"1     6       5       STRING       \"é\"     é\n" +
+			"1     10      9       RIGHT_PAREN  )       \n" +
+			"3     1       18      NIL          nil     \n" +
+			"3     4       21      EOF                  \n"},
+	}
+	for _, test := range tests {
+		var stdout, stderr strings.Builder
+		lox := &Lox{Mode: ModeTokenize, OutputFormat: test.format, Stdout: &stdout, Stderr: &stderr}
+		lox.Run(source)
+		if stdout.String() != test.stdout || stderr.Len() > 0 {
+			t.Errorf("%s: got stdout\n%s\nstderr %q, want\n%s", test.format, stdout.String(), stderr.String(), test.stdout)
+		}
+	}
+}
+
+// Tokens keep streaming past a lexical error, which goes to stderr.
+func TestTokenFormatsWithErrors(t *testing.T) {
+	var stdout, stderr strings.Builder
+	lox := &Lox{Mode: ModeTokenize, OutputFormat: FormatJson, Stdout: &stdout, Stderr: &stderr}
+	lox.Run("1 @")
+	want := `{"type":"NUMBER","lexeme":"1","literal":1,"line":1,"column":1,"offset":0}
+{"type":"EOF","lexeme":"","literal":null,"line":1,"column":4,"offset":3}
+`
+	if !lox.HadError || stdout.String() != want || stderr.String() != "[line 1] Error: Unexpected character: @\n" {
+		t.Errorf("got stdout %q stderr %q", stdout.String(), stderr.String())
+	}
+}
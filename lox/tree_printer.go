@@ -0,0 +1,62 @@
+package lox
+
+import "strings"
+
+type TreePrinter struct {
+}
+
+// treeNode is what the visit methods return, the printer writes the lines.
+type treeNode struct {
+	label    string
+	children []Expr
+}
+
+func (t TreePrinter) VisitExprTernary(ternary Ternary) any {
+	return t.node("Ternary", ternary.Condition, ternary.TrueExpr, ternary.FalseExpr)
+}
+
+func (t TreePrinter) VisitExprBinary(binary Binary) any {
+	return t.node("Binary "+binary.Operator.Lexeme, binary.Left, binary.Right)
+}
+
+func (t TreePrinter) VisitExprGrouping(grouping Grouping) any {
+	return t.node("Grouping", grouping.Expression)
+}
+
+func (t TreePrinter) VisitExprLiteral(literal Literal) any {
+	return t.node("Literal " + sourceLiteral(literal.Value))
+}
+
+func (t TreePrinter) VisitExprUnary(unary Unary) any {
+	return t.node("Unary "+unary.Operator.Lexeme, unary.Right)
+}
+
+func (t TreePrinter) node(label string, children ...Expr) any {
+	return treeNode{label, children}
+}
+
+// write adds the line for expr after prefix, its children are written below
+// it after indent.
+func (t TreePrinter) write(sb *strings.Builder, expr Expr, prefix string, indent string) {
+	node := expr.Accept(t).(treeNode)
+	sb.WriteString(prefix)
+	sb.WriteString(node.label)
+	sb.WriteString("\n")
+	for i, child := range node.children {
+		if i == len(node.children)-1 {
+			t.write(sb, child, indent+"└── ", indent+"    ")
+		} else {
+			t.write(sb, child, indent+"├── ", indent+"│   ")
+		}
+	}
+}
+
+func (t TreePrinter) Print(expr Expr) string {
+	var sb strings.Builder
+	t.write(&sb, expr, "", "")
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func NewTreePrinter() TreePrinter {
+	return TreePrinter{}
+}
@@ -0,0 +1,86 @@
+package lox
+
+import "math"
+
+// Binding power of each rule in the grammar in parser.go, from loosest to
+// tightest.
+const (
+	precTernary = iota
+	precEquality
+	precComparison
+	precTerm
+	precFactor
+	precUnary
+	precPrimary
+)
+
+// Unparser turns an expression back into Lox source with only the
+// parentheses the precedence rules require, so parsing its output gives the
+// same tree up to groupings.
+type Unparser struct {
+}
+
+type unparsed struct {
+	text       string
+	precedence int
+}
+
+func (t Unparser) VisitExprTernary(ternary Ternary) any {
+	condition := t.operand(ternary.Condition, precTernary+1)
+	trueExpr := t.operand(ternary.TrueExpr, precTernary)
+	falseExpr := t.operand(ternary.FalseExpr, precTernary)
+	return unparsed{condition + " ? " + trueExpr + " : " + falseExpr, precTernary}
+}
+
+func (t Unparser) VisitExprBinary(binary Binary) any {
+	precedence := binaryPrecedence(binary.Operator.Type)
+	// Every binary operator is left associative, an operand of the same
+	// precedence on the right needs parentheses to keep its place.
+	left := t.operand(binary.Left, precedence)
+	right := t.operand(binary.Right, precedence+1)
+	return unparsed{left + " " + binary.Operator.Lexeme + " " + right, precedence}
+}
+
+func (t Unparser) VisitExprGrouping(grouping Grouping) any {
+	return grouping.Expression.Accept(t)
+}
+
+func (t Unparser) VisitExprLiteral(literal Literal) any {
+	if number, ok := literal.Value.(float64); ok && math.Signbit(number) {
+		return unparsed{sourceLiteral(number), precUnary}
+	}
+	return unparsed{sourceLiteral(literal.Value), precPrimary}
+}
+
+func (t Unparser) VisitExprUnary(unary Unary) any {
+	return unparsed{unary.Operator.Lexeme + t.operand(unary.Right, precUnary), precUnary}
+}
+
+func (t Unparser) operand(expr Expr, precedence int) string {
+	result := expr.Accept(t).(unparsed)
+	if result.precedence < precedence {
+		return "(" + result.text + ")"
+	}
+	return result.text
+}
+
+func (t Unparser) Unparse(expr Expr) string {
+	return expr.Accept(t).(unparsed).text
+}
+
+func NewUnparser() Unparser {
+	return Unparser{}
+}
+
+func binaryPrecedence(operator TokenType) int {
+	switch operator {
+	case BANG_EQUAL, EQUAL_EQUAL:
+		return precEquality
+	case GREATER, GREATER_EQUAL, LESS, LESS_EQUAL:
+		return precComparison
+	case MINUS, PLUS:
+		return precTerm
+	default:
+		return precFactor
+	}
+}
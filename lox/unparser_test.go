@@ -0,0 +1,103 @@
+package lox
+
+import (
+	"strings"
+	"testing"
+)
+
+func parseExpr(t *testing.T, source string) Expr {
+	t.Helper()
+	var stderr strings.Builder
+	expr := (&Lox{Stderr: &stderr}).Parse(strings.NewReader(source))
+	if expr == nil {
+		t.Fatalf("%q: %s", source, stderr.String())
+	}
+	return expr
+}
+
+// withoutGroupings drops the groupings the unparser is free to change, and
+// reads a negated number the way the optimizer folds it, as a literal.
+func withoutGroupings(expr Expr) Expr {
+	switch expr := expr.(type) {
+	case Ternary:
+		return Ternary{withoutGroupings(expr.Condition), expr.Question, withoutGroupings(expr.TrueExpr), withoutGroupings(expr.FalseExpr)}
+	case Binary:
+		return Binary{withoutGroupings(expr.Left), expr.Operator, withoutGroupings(expr.Right)}
+	case Grouping:
+		return withoutGroupings(expr.Expression)
+	case Unary:
+		right := withoutGroupings(expr.Right)
+		if literal, ok := right.(Literal); ok && expr.Operator.Type == MINUS {
+			if number, ok := literal.Value.(float64); ok {
+				return Literal{Value: -number}
+			}
+		}
+		return Unary{expr.Operator, right}
+	}
+	return expr
+}
+
+func TestUnparseRoundTrip(t *testing.T) {
+	tests := []struct {
+		source   string
+		optimize bool
+		unparsed string
+	}{
+		{"1 + 2 * 3", false, "1 + 2 * 3"},
+		{"(1 + 2) * 3", false, "(1 + 2) * 3"},
+		{"((1)) == (2 < 3)", false, "1 == 2 < 3"},
+		{"1 == (2 == 3)", false, "1 == (2 == 3)"},
+		{"(1 == 2) == 3", false, "1 == 2 == 3"},
+		{"1 - (2 - 3)", false, "1 - (2 - 3)"},
+		{"1 - 2 - 3", false, "1 - 2 - 3"},
+		{"8 / (4 / 2) * 1", false, "8 / (4 / 2) * 1"},
+		{"!(!true) == -(-(1))", false, "!!true == --1"},
+		{"-(1 + 2)", false, "-(1 + 2)"},
+		{"true ? 1 : false ? 2 : 3", false, "true ? 1 : false ? 2 : 3"},
+		{"(true ? false : true) ? 1 : 2", false, "(true ? false : true) ? 1 : 2"},
+		{"true ? (false ? 1 : 2) : 3", false, "true ? false ? 1 : 2 : 3"},
+		{"(true ? 1 : 2) + 3", false, "(true ? 1 : 2) + 3"},
+		{"1 < 2 == (nil ? \"a\" : \"b\")", false, "1 < 2 == (nil ? \"a\" : \"b\")"},
+		{"-1 - \"a\"", true, "-1 - \"a\""},
+		{"\"a\" - -2.5", true, "\"a\" - -2.5"},
+		{"-(-1 < \"a\")", true, "-(-1 < \"a\")"},
+		{"-(-1) * -\"a\"", true, "1 * -\"a\""},
+		{"0 * -1 + nil", true, "-0 + nil"},
+	}
+	for _, test := range tests {
+		expr := parseExpr(t, test.source)
+		if test.optimize {
+			expr = Optimize(expr)
+		}
+		unparsed := NewUnparser().Unparse(expr)
+		if unparsed != test.unparsed {
+			t.Errorf("%s: unparsed as %q, want %q", test.source, unparsed, test.unparsed)
+		}
+		want, got := PrintAst(withoutGroupings(expr)), PrintAst(withoutGroupings(parseExpr(t, unparsed)))
+		if got != want {
+			t.Errorf("%s: %q parses as %s, want %s", test.source, unparsed, got, want)
+		}
+	}
+}
+
+func TestRPNPrinter(t *testing.T) {
+	tests := []struct {
+		source string
+		rpn    string
+	}{
+		{"1", "1"},
+		{"1 + 2 * 3", "1 2 3 * +"},
+		{"(1 + 2) * 3", "1 2 + 3 *"},
+		{"1 - 2 - 3", "1 2 - 3 -"},
+		{"1 - (2 - 3)", "1 2 3 - -"},
+		{"-1 - -(2)", "1 neg 2 neg -"},
+		{"!true == !!nil", "true ! nil ! ! =="},
+		{"1 < 2 ? \"yes\" : \"no\"", "1 2 < \"yes\" \"no\" ?:"},
+		{"true ? 1 : false ? 2 : 3", "true 1 false 2 3 ?: ?:"},
+	}
+	for _, test := range tests {
+		if rpn := NewRPNPrinter().Print(parseExpr(t, test.source)); rpn != test.rpn {
+			t.Errorf("%s: got %q, want %q", test.source, rpn, test.rpn)
+		}
+	}
+}
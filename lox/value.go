@@ -0,0 +1,119 @@
+package lox
+
+import "fmt"
+
+type ValueKind byte
+
+const (
+	ValNil ValueKind = iota
+	ValBool
+	ValNumber
+	ValString
+)
+
+// Value is a Lox value. Numbers and booleans are stored inline in Number,
+// booleans as 0 or 1, and strings point to an ObjString.
+type Value struct {
+	Kind   ValueKind
+	Number float64
+	Obj    Obj
+}
+
+func NilValue() Value {
+	return Value{Kind: ValNil}
+}
+
+func BoolValue(b bool) Value {
+	if b {
+		return Value{Kind: ValBool, Number: 1}
+	}
+	return Value{Kind: ValBool}
+}
+
+func NumberValue(number float64) Value {
+	return Value{Kind: ValNumber, Number: number}
+}
+
+func StringValue(str *ObjString) Value {
+	return Value{Kind: ValString, Obj: str}
+}
+
+// ValueOf converts a literal from the AST, or a constant, into a Value.
+// Strings are not allocated on any VM heap.
+func ValueOf(literal any) Value {
+	switch v := literal.(type) {
+	case bool:
+		return BoolValue(v)
+	case float64:
+		return NumberValue(v)
+	case string:
+		return StringValue(&ObjString{Chars: v})
+	default:
+		return NilValue()
+	}
+}
+
+func (v Value) IsNil() bool {
+	return v.Kind == ValNil
+}
+
+func (v Value) IsNumber() bool {
+	return v.Kind == ValNumber
+}
+
+func (v Value) IsString() bool {
+	return v.Kind == ValString
+}
+
+func (v Value) AsBool() bool {
+	return v.Number != 0
+}
+
+func (v Value) AsString() *ObjString {
+	return v.Obj.(*ObjString)
+}
+
+func (v Value) IsTruthy() bool {
+	switch v.Kind {
+	case ValNil:
+		return false
+	case ValBool:
+		return v.AsBool()
+	default:
+		return true
+	}
+}
+
+// Strings from the VM heap are interned and usually match on the pointer
+// alone, strings built by the Interpreter fall back to their characters.
+func (v Value) Equals(other Value) bool {
+	if v.Kind != other.Kind {
+		return false
+	}
+
+	switch v.Kind {
+	case ValNil:
+		return true
+	case ValString:
+		return v.Obj == other.Obj || v.AsString().Chars == other.AsString().Chars
+	default:
+		return v.Number == other.Number
+	}
+}
+
+func (v Value) String() string {
+	switch v.Kind {
+	case ValNil:
+		return "nil"
+	case ValBool:
+		return fmt.Sprint(v.AsBool())
+	case ValNumber:
+		text := FormatNumber(v.Number)
+		if text[len(text)-2:] == ".0" {
+			return text[:len(text)-2]
+		}
+		return text
+	default:
+		return v.AsString().Chars
+	}
+}
@@ -0,0 +1,247 @@
+package lox
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// VM executes compiled chunks on a value stack. It produces the same output
+// and runtime errors as the tree-walking Interpreter.
+type VM struct {
+	lox       *Lox
+	chunk     *Chunk
+	constants []Value
+	ip        int
+	stack     []Value
+	Heap      Heap
+	Limits    Limits
+	limiter   *limiter
+
+	// When set, the stack and the next instruction are written here before
+	// every instruction executes.
+	Trace io.Writer
+}
+
+func NewVM(lox *Lox) *VM {
+	return &VM{lox: lox}
+}
+
+func (vm *VM) Interpret(chunk *Chunk) {
+	vm.InterpretContext(context.Background(), chunk)
+}
+
+// InterpretContext stops with an error once ctx is done or one of the VM's
+// Limits is exceeded.
+func (vm *VM) InterpretContext(ctx context.Context, chunk *Chunk) {
+	vm.limiter = newLimiter(ctx, vm.Limits)
+	value, err := vm.run(chunk)
+	if err != nil {
+		vm.lox.RuntimeError(err)
+		return
+	}
+
+	fmt.Fprintln(vm.lox.stdout(), value)
+}
+
+func (vm *VM) run(chunk *Chunk) (Value, error) {
+	vm.chunk = chunk
+	vm.ip = 0
+	vm.stack = vm.stack[:0]
+
+	// String constants become heap objects once, up front
+	vm.constants = make([]Value, len(chunk.Constants))
+	for i, constant := range chunk.Constants {
+		if constant.IsString() {
+			str, err := vm.newString(constant.AsString().Chars)
+			if err != nil {
+				return Value{}, err
+			}
+			constant = StringValue(str)
+		}
+		vm.constants[i] = constant
+	}
+
+	for {
+		if vm.Trace != nil {
+			vm.traceInstruction()
+		}
+
+		op := OpCode(vm.readByte())
+
+		err := vm.limiter.step(vm.errorToken)
+		if err == nil {
+			err = vm.limiter.nest(len(vm.stack), vm.errorToken)
+		}
+		if err != nil {
+			return Value{}, err
+		}
+
+		switch op {
+		case OpConstant:
+			vm.push(vm.constants[vm.readByte()])
+		case OpConstantLong:
+			index := int(vm.readByte())<<16 | int(vm.readByte())<<8 | int(vm.readByte())
+			vm.push(vm.constants[index])
+		case OpNil:
+			vm.push(NilValue())
+		case OpTrue:
+			vm.push(BoolValue(true))
+		case OpFalse:
+			vm.push(BoolValue(false))
+		case OpEqual:
+			right, left := vm.pop(), vm.pop()
+			vm.push(BoolValue(left.Equals(right)))
+		case OpNotEqual:
+			right, left := vm.pop(), vm.pop()
+			vm.push(BoolValue(!left.Equals(right)))
+		case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpSubtract, OpMultiply, OpDivide:
+			if !vm.numberOperands() {
+				return Value{}, vm.error("Operands must be numbers.")
+			}
+			right, left := vm.pop(), vm.pop()
+			vm.push(numberOp(op, left.Number, right.Number))
+		case OpAdd:
+			if vm.numberOperands() {
+				right, left := vm.pop(), vm.pop()
+				vm.push(NumberValue(left.Number + right.Number))
+				continue
+			}
+			right, left := vm.peek(0), vm.peek(1)
+			if !left.IsString() || !right.IsString() {
+				return Value{}, vm.error("Operands must be two numbers or two strings")
+			}
+			// Both operands stay on the stack until the result is allocated
+			// so a collection can not free them.
+			result, err := vm.newString(left.AsString().Chars + right.AsString().Chars)
+			if err != nil {
+				return Value{}, err
+			}
+			vm.pop()
+			vm.pop()
+			vm.push(StringValue(result))
+		case OpNot:
+			vm.push(BoolValue(!vm.pop().IsTruthy()))
+		case OpNegate:
+			if !vm.peek(0).IsNumber() {
+				return Value{}, vm.error("Operand must be a number.")
+			}
+			vm.push(NumberValue(-vm.pop().Number))
+		case OpReturn:
+			return vm.pop(), nil
+		case OpJump:
+			vm.ip += vm.readJump()
+		case OpJumpIfFalse:
+			jump := vm.readJump()
+			if !vm.pop().IsTruthy() {
+				vm.ip += jump
+			}
+		}
+	}
+}
+
+// Strings are interned, two strings with the same characters are always the
+// same object and can be compared by pointer.
+func (vm *VM) newString(chars string) (*ObjString, error) {
+	if str, ok := vm.Heap.strings[chars]; ok {
+		return str, nil
+	}
+
+	size := objStringSize + len(chars)
+	err := vm.limiter.allocate(size, vm.errorToken)
+	if err != nil {
+		return nil, err
+	}
+	str := &ObjString{Chars: chars}
+	err = vm.Heap.allocate(str, size, vm.markRoots)
+	if err != nil {
+		return nil, vm.error(err.Error())
+	}
+
+	if vm.Heap.strings == nil {
+		vm.Heap.strings = map[string]*ObjString{}
+	}
+	vm.Heap.strings[chars] = str
+	return str, nil
+}
+
+// The roots are everything the running chunk can still reach: the values on
+// the stack and the constant table.
+func (vm *VM) markRoots() {
+	for _, value := range vm.stack {
+		vm.Heap.markValue(value)
+	}
+	for _, value := range vm.constants {
+		vm.Heap.markValue(value)
+	}
+}
+
+func (vm *VM) traceInstruction() {
+	fmt.Fprint(vm.Trace, "          ")
+	for _, value := range vm.stack {
+		fmt.Fprintf(vm.Trace, "[ %s ]", value)
+	}
+	fmt.Fprintln(vm.Trace)
+	DisassembleInstruction(vm.Trace, vm.chunk, vm.ip)
+}
+
+func (vm *VM) readByte() byte {
+	b := vm.chunk.Code[vm.ip]
+	vm.ip++
+	return b
+}
+
+func (vm *VM) readJump() int {
+	jump := vm.chunk.jumpOffset(vm.ip - 1)
+	vm.ip += 3
+	return jump
+}
+
+func (vm *VM) push(value Value) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() Value {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *VM) peek(distance int) Value {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+func (vm *VM) numberOperands() bool {
+	return vm.peek(1).IsNumber() && vm.peek(0).IsNumber()
+}
+
+// The instruction that failed is the one just read, ip already points past
+// it and any operands.
+func (vm *VM) error(message string) error {
+	return RuntimeError{vm.errorToken(), message}
+}
+
+// Before the first instruction is read this is the first line.
+func (vm *VM) errorToken() Token {
+	offset := max(vm.ip-1, 0)
+	return Token{Line: vm.chunk.Line(offset), Column: vm.chunk.Column(offset)}
+}
+
+func numberOp(op OpCode, left, right float64) Value {
+	switch op {
+	case OpGreater:
+		return BoolValue(left > right)
+	case OpGreaterEqual:
+		return BoolValue(left >= right)
+	case OpLess:
+		return BoolValue(left < right)
+	case OpLessEqual:
+		return BoolValue(left <= right)
+	case OpSubtract:
+		return NumberValue(left - right)
+	case OpMultiply:
+		return NumberValue(left * right)
+	default:
+		return NumberValue(left / right)
+	}
+}
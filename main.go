@@ -2,54 +2,243 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
 
 	"github.com/elordeiro/GoLox/lox"
 )
 
 type Config struct {
-	Filename string
-	RunRepl  bool
-	Mode     int
+	Filenames []string
+	Source    string
+	Args      []string
+	Format    string
+	Backend   string
+	Trace     bool
+	OptLevel  int
+	GCStress  bool
+	GCStats   bool
+	MaxHeap   int
+	Limits    lox.Limits
+	RunRepl   bool
+	Mode      int
+}
+
+// version is set at build time with -ldflags "-X main.version=<version>",
+// otherwise it comes from the module version go install records.
+var version = ""
+
+const usage = `Usage: ./golox.sh <command> [flags] [arguments]
+
+Commands:
+	run [<filename>...]         Run source or compiled (.loxc) files
+	repl                        Start an interactive session
+	tokenize [<filename>...]    Print the tokens of each file
+	parse [<filename>...]       Print the AST of each file
+	evaluate [<filename>...]    Evaluate each file and print its value
+	check [<filename>...]       Report syntax errors without running anything
+	disassemble [<filename>...] Print the bytecode compiled from each file
+	compile <filename>          Compile a file to bytecode (.loxc)
+	fmt <filename>...           Print the formatted source of each file
+	debug <filename>            Step through a file, type help at the prompt for commands
+	dap                         Debug Adapter Protocol server on stdin and stdout
+	lsp                         Language Server Protocol server on stdin and stdout
+	version                     Print the version
+	help                        Display this help message
+
+A filename of - reads stdin, and -e <source> runs source given on the command
+line instead of files. Without files or -e, tokenize, parse, evaluate and run
+start a REPL in that mode, and so does ./golox.sh on its own. ./golox.sh
+<filename> is short for ./golox.sh run <filename>, and a leading #! line in a
+file is ignored, so scripts can start with #!/usr/bin/env golox.
+
+Run ./golox.sh <command> -h for the flags of a command.
+
+Exit codes: 64 for usage errors, 65 for syntax errors and malformed input,
+70 for runtime errors and 74 for I/O errors.
+`
+
+var commandUsages = map[string]string{
+	"run":         "run [flags] [<filename>... | -e <source>]",
+	"repl":        "repl [flags]",
+	"tokenize":    "tokenize [flags] [<filename>... | -e <source>]",
+	"parse":       "parse [flags] [<filename>... | -e <source>]",
+	"evaluate":    "evaluate [flags] [<filename>... | -e <source>]",
+	"check":       "check [<filename>... | -e <source>]",
+	"disassemble": "disassemble [flags] [<filename>... | -e <source>]",
+	"compile":     "compile [-o <output>] [--opt-level=0|1] <filename>",
+	"fmt":         "fmt [--check] [-w] <filename>...",
+	"debug":       "debug [flags] <filename>",
 }
 
 func main() {
 	config := parseArgs()
 
-	if config.Mode == lox.ModeHelp {
-		fmt.Fprintln(os.Stderr, "Usage: ")
-		fmt.Fprintln(os.Stderr, "\t./golox.sh                     # Repl Mode - Currently default opt produces AST")
-		fmt.Fprintln(os.Stderr, "\t./golox.sh tokenize            # Repl Mode - Produces tokens")
-		fmt.Fprintln(os.Stderr, "\t./golox.sh tokenize <filename> # Tokenize file")
-		fmt.Fprintln(os.Stderr, "\t./golox.sh parse               # Parse Mode - Produces AST")
-		fmt.Fprintln(os.Stderr, "\t./golox.sh parse <filename>    # Parse file")
-		fmt.Fprintln(os.Stderr, "\t./golox.sh evaluate            # Evaluate Mode - Produces output")
-		fmt.Fprintln(os.Stderr, "\t./golox.sh evaluate <filename> # Evaluate file")
-		fmt.Fprintln(os.Stderr, "\t./golox.sh help                # Display this help message")
-		os.Exit(1)
+	switch {
+	case config.Mode == lox.ModeHelp:
+		fmt.Print(usage)
+	case config.Mode == lox.ModeVersion:
+		fmt.Printf("golox %s\n", versionString())
+	case config.Mode == lox.ModeFormat:
+		runFmt(config)
+	case config.Mode == lox.ModeCompile:
+		runCompile(config)
+	case config.Mode == lox.ModeDebug:
+		runDebug(config)
+	case config.Mode == lox.ModeDap:
+		runDap()
+	case config.Mode == lox.ModeLsp:
+		runLsp()
+	case config.RunRepl:
+		runPrompt(config)
+	default:
+		runFiles(config)
 	}
+}
 
-	if config.Mode == lox.ModeUnknown {
-		fmt.Fprintf(os.Stderr, "Unknown command %s\n", os.Args[1])
-		os.Exit(1)
+func versionString() string {
+	if version != "" {
+		return version
 	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
 
-	if config.RunRepl {
-		runPrompt(config)
+// runFiles runs every file even after one fails, and exits with the status
+// of the first failure. A single file reports errors by line only, which is
+// what the reference test suite expects, otherwise errors point into their
+// file with file:line:col.
+func runFiles(config *Config) {
+	files := lox.NewFileSet()
+	located := len(config.Filenames) > 1 || config.Source != ""
+
+	status := 0
+	if config.Source != "" {
+		status = runSource(config, strings.NewReader(config.Source), "-e", files.AddVirtual("-e", config.Source))
+	}
+	for _, filename := range config.Filenames {
+		var source *lox.SourceFile
+		if located {
+			source = files.AddFile(filename)
+			if filename == "-" {
+				source.Name = "<stdin>"
+			}
+		}
+		code := 74
+		if file, err := openFile(filename); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		} else {
+			code = runSource(config, file, filename, source)
+			file.Close()
+		}
+		if status == 0 {
+			status = code
+		}
+	}
+	os.Exit(status)
+}
+
+func runSource(config *Config, reader io.Reader, name string, source *lox.SourceFile) int {
+	input := bufio.NewReader(reader)
+
+	var chunk *lox.Chunk
+	if config.Mode == lox.ModeInterpret && lox.IsChunkFile(input) {
+		var err error
+		chunk, err = lox.LoadChunk(input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", name, err)
+			return 65
+		}
+	}
+
+	lox := newLox(config, config.Mode)
+	lox.Source = source
+	if chunk != nil {
+		lox.RunChunk(chunk)
 	} else {
-		runFile(config)
+		lox.RunReader(input)
+	}
+	if lox.HadError {
+		return 65
+	}
+	if lox.HadRuntimeError {
+		return 70
+	}
+	return 0
+}
+
+func newLox(config *Config, mode int) *lox.Lox {
+	return &lox.Lox{
+		HadError:     false,
+		Mode:         mode,
+		OutputFormat: config.Format,
+		Backend:      config.Backend,
+		Trace:        config.Trace,
+		OptLevel:     config.OptLevel,
+		GCStress:     config.GCStress,
+		GCStats:      config.GCStats,
+		MaxHeap:      config.MaxHeap,
+		Limits:       config.Limits,
 	}
 }
 
-func runFile(config *Config) {
-	lox := &lox.Lox{HadError: false, Mode: config.Mode}
-	fileContents, err := os.ReadFile(config.Filename)
+func runCompile(config *Config) {
+	flags := newFlagSet("compile")
+	output := flags.String("o", "", "output file, defaults to the input file with a .loxc extension")
+	optLevel := flags.Int("opt-level", 1, "0 disables constant folding")
+	args := parseFlags(flags, config.Args)
+
+	if len(args) != 1 || (args[0] == "-" && *output == "") {
+		usageError(flags, "expected one file, and -o when reading stdin")
+	}
+	filename := args[0]
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, ".lox") + ".loxc"
+	}
+
+	source, err := openFile(filename)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
-		os.Exit(1)
+		os.Exit(74)
 	}
-	lox.Run(string(fileContents))
+	lox := &lox.Lox{HadError: false, Mode: config.Mode, OptLevel: *optLevel}
+	chunk := lox.CompileReader(source)
+	source.Close()
+	if lox.HadError {
+		os.Exit(65)
+	}
+
+	file, err := os.Create(*output)
+	if err == nil {
+		err = chunk.Save(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
+		os.Exit(74)
+	}
+}
+
+// Commands are read from stdin, so the program has to come from a file.
+func runDebug(config *Config) {
+	fileContents, err := os.ReadFile(config.Filenames[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		os.Exit(74)
+	}
+
+	lox := newLox(config, config.Mode)
+	lox.Debug(string(fileContents), os.Stdin, os.Stdout)
 	if lox.HadError {
 		os.Exit(65)
 	}
@@ -58,27 +247,136 @@ func runFile(config *Config) {
 	}
 }
 
-func runPrompt(config *Config) {
-	lox := &lox.Lox{HadError: false, Mode: lox.ModeParse}
-	if config.Mode > 0 {
-		lox.Mode = config.Mode
+// The protocol is spoken on stdin and stdout, what the program prints is sent
+// to the client as output events.
+func runDap() {
+	err := lox.NewDapServer(os.Stdin, os.Stdout).Serve()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading request: %v\n", err)
+		os.Exit(74)
+	}
+}
+
+// The client is expected to ask for a shutdown before it sends exit, the
+// protocol asks for status 1 when it did not.
+func runLsp() {
+	shutdown, err := lox.NewLspServer(os.Stdin, os.Stdout).Serve()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading message: %v\n", err)
+		os.Exit(74)
+	}
+	if !shutdown {
+		os.Exit(1)
+	}
+}
+
+func openFile(filename string) (io.ReadCloser, error) {
+	if filename == "-" {
+		return io.NopCloser(os.Stdin), nil
 	}
-	reader := bufio.NewReader(os.Stdin)
+	return os.Open(filename)
+}
+
+// Like gofmt -l, --check exits 1 when a file is not formatted. As with the
+// other commands every file is processed and the first failure decides the
+// exit status.
+func runFmt(config *Config) {
+	flags := newFlagSet("fmt")
+	check := flags.Bool("check", false, "list files whose formatting differs and exit 1")
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	filenames := parseFlags(flags, config.Args)
+
+	if len(filenames) == 0 {
+		usageError(flags, "expected at least one file")
+	}
+
+	files := lox.NewFileSet()
+	status := 0
+	fail := func(code int) {
+		if status == 0 {
+			status = code
+		}
+	}
+	for _, filename := range filenames {
+		fileContents, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			fail(74)
+			continue
+		}
+
+		lox := &lox.Lox{HadError: false, Mode: config.Mode}
+		if len(filenames) > 1 {
+			lox.Source = files.AddVirtual(filename, string(fileContents))
+		}
+		formatted := lox.Format(string(fileContents))
+		if lox.HadError {
+			fail(65)
+			continue
+		}
+
+		changed := formatted != string(fileContents)
+		if *check {
+			if changed {
+				fmt.Println(filename)
+				fail(1)
+			}
+			continue
+		}
+		if *write {
+			if changed {
+				err := os.WriteFile(filename, []byte(formatted), 0644)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
+					fail(74)
+				}
+			}
+			continue
+		}
+		fmt.Print(formatted)
+	}
+
+	os.Exit(status)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: ./golox.sh %s\n", commandUsages[name])
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags allows flags after the arguments, like in
+// ./golox.sh tokenize file.lox --format=json, and returns the arguments.
+func parseFlags(flags *flag.FlagSet, args []string) []string {
+	var operands []string
 	for {
-		fmt.Print("> ")
-		var input string
-		input, _ = reader.ReadString('\n')
-		if input == "exit()\n" {
-			os.Exit(1)
+		err := flags.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
 		}
-		lox.Run(input)
+		if err != nil {
+			os.Exit(64)
+		}
+		if flags.NArg() == 0 {
+			return operands
+		}
+		operands = append(operands, flags.Arg(0))
+		args = flags.Args()[1:]
 	}
 }
 
+func usageError(flags *flag.FlagSet, message string) {
+	fmt.Fprintf(flags.Output(), "%s: %s\n", flags.Name(), message)
+	flags.Usage()
+	os.Exit(64)
+}
+
 func parseArgs() *Config {
 	config := &Config{
-		Filename: "",
-		Mode:     lox.ModeInterpret,
+		Mode: lox.ModeInterpret,
 	}
 
 	if len(os.Args) == 1 {
@@ -87,38 +385,155 @@ func parseArgs() *Config {
 		return config
 	}
 
-	if len(os.Args) == 2 {
-		switch os.Args[1] {
-		case "tokenize":
-			config.Mode = lox.ModeTokenize
-		case "parse":
-			config.Mode = lox.ModeParse
-		case "evaluate":
-			config.Mode = lox.ModeEvaluate
-		case "help":
-			config.Mode = lox.ModeHelp
-		default:
-			config.Mode = lox.ModeUnknown
-		}
-		config.RunRepl = true
+	name, args := os.Args[1], os.Args[2:]
+	switch name {
+	case "fmt":
+		config.Mode = lox.ModeFormat
+		config.Args = args
+		return config
+	case "compile":
+		config.Mode = lox.ModeCompile
+		config.Args = args
 		return config
+	case "help", "-h", "-help", "--help":
+		config.Mode = lox.ModeHelp
+	case "version", "-version", "--version":
+		config.Mode = lox.ModeVersion
+	case "dap":
+		config.Mode = lox.ModeDap
+	case "lsp":
+		config.Mode = lox.ModeLsp
+	case "debug":
+		config.Mode = lox.ModeDebug
+	case "repl":
+		config.Mode = lox.ModeRepl
+	case "check":
+		config.Mode = lox.ModeCheck
+	case "tokenize":
+		config.Mode = lox.ModeTokenize
+	case "parse":
+		config.Mode = lox.ModeParse
+	case "evaluate":
+		config.Mode = lox.ModeEvaluate
+	case "run":
+		config.Mode = lox.ModeInterpret
+	case "disassemble":
+		config.Mode = lox.ModeDisassemble
+	default:
+		// ./golox.sh script.lox, as a #!/usr/bin/env golox line runs it.
+		// Whatever follows would be the script's own arguments, which Lox
+		// has no way to read, so they are neither flags nor more files.
+		if _, err := os.Stat(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Unknown command %s\n\n%s", name, usage)
+			os.Exit(64)
+		}
+		if len(args) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: scripts take no arguments\n", name)
+			os.Exit(64)
+		}
+		name, args = "run", []string{"--", name}
 	}
 
-	if len(os.Args) == 3 {
-		switch os.Args[1] {
-		case "tokenize":
-			config.Mode = lox.ModeTokenize
-		case "parse":
-			config.Mode = lox.ModeParse
-		case "evaluate":
-			config.Mode = lox.ModeEvaluate
-		default:
-			config.Mode = lox.ModeUnknown
+	switch config.Mode {
+	case lox.ModeHelp, lox.ModeVersion, lox.ModeDap, lox.ModeLsp:
+		if len(args) > 0 {
+			fmt.Fprintf(os.Stderr, "%s takes no arguments\n", name)
+			os.Exit(64)
 		}
-		config.Filename = os.Args[2]
 		return config
 	}
 
-	config.Mode = lox.ModeUnknown
+	flags := newFlagSet(name)
+	formats := []string{""}
+	switch config.Mode {
+	case lox.ModeTokenize:
+		formats = lox.TokenFormats
+	case lox.ModeParse:
+		formats = lox.AstFormats
+	}
+	if len(formats) > 1 {
+		flags.StringVar(&config.Format, "format", formats[0], "output format: "+strings.Join(formats, ", "))
+	}
+	switch config.Mode {
+	case lox.ModeEvaluate, lox.ModeInterpret, lox.ModeRepl:
+		flags.StringVar(&config.Backend, "backend", lox.BackendTree, "execution backend: "+strings.Join(lox.Backends, ", "))
+		flags.BoolVar(&config.Trace, "trace", false, "log the VM stack before each instruction")
+		flags.BoolVar(&config.GCStress, "gc-stress", false, "run the garbage collector before every allocation")
+		flags.BoolVar(&config.GCStats, "gc-stats", false, "print garbage collector statistics when done")
+		flags.IntVar(&config.MaxHeap, "max-heap", 0, "limit the VM heap to this many bytes, 0 means no limit")
+	}
+	switch config.Mode {
+	case lox.ModeEvaluate, lox.ModeInterpret, lox.ModeRepl, lox.ModeDebug:
+		flags.IntVar(&config.Limits.MaxSteps, "max-steps", 0, "stop after evaluating this many expressions or instructions")
+		flags.IntVar(&config.Limits.MaxDepth, "max-depth", 0, "stop when expressions nest or the VM stack grows deeper than this")
+		flags.DurationVar(&config.Limits.MaxDuration, "timeout", 0, "stop after running this long, e.g. 500ms")
+		flags.IntVar(&config.Limits.MaxAllocBytes, "max-alloc", 0, "stop after allocating this many bytes in total")
+	}
+	optimized := false
+	switch config.Mode {
+	case lox.ModeParse:
+		flags.BoolVar(&optimized, "optimized", false, "print the AST after constant folding")
+	case lox.ModeEvaluate, lox.ModeInterpret, lox.ModeDisassemble:
+		flags.IntVar(&config.OptLevel, "opt-level", 1, "0 disables constant folding")
+	}
+	replMode := "evaluate"
+	if config.Mode == lox.ModeRepl {
+		flags.StringVar(&replMode, "mode", replMode, "what to do with each entry: tokenize, parse, evaluate or run")
+	} else if config.Mode != lox.ModeDebug {
+		flags.StringVar(&config.Source, "e", "", "use this source instead of reading files")
+	}
+	config.Filenames = parseFlags(flags, args)
+	if config.Source != "" && len(config.Filenames) > 0 {
+		usageError(flags, "-e cannot be combined with files")
+	}
+
+	if optimized {
+		config.OptLevel = 1
+	}
+
+	if !slices.Contains(formats, config.Format) {
+		usageError(flags, "unknown format "+config.Format)
+	}
+	if config.Backend != "" && !slices.Contains(lox.Backends, config.Backend) {
+		usageError(flags, "unknown backend "+config.Backend)
+	}
+	if config.OptLevel < 0 || config.OptLevel > 1 {
+		usageError(flags, fmt.Sprintf("unknown optimization level %d", config.OptLevel))
+	}
+	if config.Backend != lox.BackendVM {
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "trace", "gc-stress", "gc-stats", "max-heap":
+				usageError(flags, fmt.Sprintf("--%s requires --backend=vm", f.Name))
+			}
+		})
+	}
+
+	switch config.Mode {
+	case lox.ModeRepl:
+		mode, ok := replModes[replMode]
+		if !ok {
+			usageError(flags, "unknown mode "+replMode)
+		}
+		config.Mode = mode
+		config.RunRepl = true
+		// Entries are folded like evaluate and run do by default
+		config.OptLevel = 1
+		if len(config.Filenames) > 0 {
+			usageError(flags, "unexpected arguments")
+		}
+	case lox.ModeDebug:
+		if len(config.Filenames) != 1 || config.Filenames[0] == "-" {
+			usageError(flags, "expected one file, stdin is used for commands")
+		}
+	case lox.ModeCheck:
+		if len(config.Filenames) == 0 && config.Source == "" {
+			usageError(flags, "expected files or -e")
+		}
+	default:
+		if len(config.Filenames) == 0 && config.Source == "" {
+			config.RunRepl = true
+		}
+	}
 	return config
 }
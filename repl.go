@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elordeiro/GoLox/lox"
+)
+
+type repl struct {
+	config  *Config
+	session *lox.Lox
+	editor  *LineEditor
+	files   *lox.FileSet
+	entries int
+}
+
+var replModes = map[string]int{
+	"tokenize": lox.ModeTokenize,
+	"parse":    lox.ModeParse,
+	"evaluate": lox.ModeEvaluate,
+	"run":      lox.ModeInterpret,
+}
+
+const replHelp = `Enter an expression to run it in the current mode, or a command:
+  :help              Show this message
+  :mode [name]       Show or switch the mode: tokenize, parse, evaluate or run
+  :load <file>       Run a file in the current mode
+  :reset             Start over with a fresh interpreter
+  :ast <expr>        Print the syntax tree of expr
+  :tokens <expr>     Print the tokens of expr
+  :time <expr>       Run expr and print how long it took
+  :quit              Leave the REPL, like Ctrl-D
+`
+
+// runPrompt returns when input ends, Ctrl-C only abandons the current entry.
+// The Lox is kept across entries so the REPL state persists until :reset.
+// Without a mode on the command line expressions are evaluated and their
+// value printed.
+func runPrompt(config *Config) {
+	mode := lox.ModeEvaluate
+	if config.Mode != lox.ModeRepl {
+		mode = config.Mode
+	}
+	r := &repl{
+		config:  config,
+		session: newLox(config, mode),
+		editor:  NewLineEditor(defaultHistoryFile()),
+		files:   lox.NewFileSet(),
+	}
+	r.editor.complete = lox.Complete
+
+	for {
+		input, err := readInput(r.editor)
+		if err == io.EOF {
+			return
+		}
+		if err == errInterrupt {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			os.Exit(74)
+		}
+
+		input = strings.TrimSpace(input)
+		switch {
+		case input == "":
+		case input == "exit()":
+			return
+		case strings.HasPrefix(input, ":"):
+			if !r.command(input[1:]) {
+				return
+			}
+		default:
+			r.run(input)
+		}
+	}
+}
+
+// command runs a REPL command and reports whether to keep reading.
+func (r *repl) command(input string) bool {
+	name, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "help", "h":
+		fmt.Print(replHelp)
+	case "quit", "q":
+		return false
+	case "mode":
+		if arg == "" {
+			for name, mode := range replModes {
+				if mode == r.session.Mode {
+					fmt.Println(name)
+				}
+			}
+			break
+		}
+		mode, ok := replModes[arg]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown mode %s, expected tokenize, parse, evaluate or run.\n", arg)
+			break
+		}
+		r.session.Mode = mode
+		// Formats belong to a mode, the new one starts with its default
+		r.session.OutputFormat = ""
+	case "load":
+		if arg == "" {
+			fmt.Fprintln(os.Stderr, "Usage: :load <file>")
+			break
+		}
+		source, err := os.ReadFile(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			break
+		}
+		r.runFile(string(source), r.files.AddFile(arg))
+	case "reset":
+		r.session = newLox(r.config, r.session.Mode)
+	case "ast":
+		r.runAs(lox.ModeParse, lox.FormatSexpr, arg)
+	case "tokens":
+		r.runAs(lox.ModeTokenize, lox.FormatText, arg)
+	case "time":
+		start := time.Now()
+		r.run(arg)
+		fmt.Printf("Took %s.\n", time.Since(start))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command :%s, try :help.\n", name)
+	}
+	return true
+}
+
+// Every entry is a virtual file, so errors name the entry they come from.
+func (r *repl) run(source string) {
+	r.entries++
+	r.runFile(source, r.files.AddVirtual(fmt.Sprintf("<repl:%d>", r.entries), source))
+}
+
+func (r *repl) runAs(mode int, format string, source string) {
+	previousMode, previousFormat := r.session.Mode, r.session.OutputFormat
+	r.session.Mode, r.session.OutputFormat = mode, format
+	r.run(source)
+	r.session.Mode, r.session.OutputFormat = previousMode, previousFormat
+}
+
+// Errors are reported as they happen and then forgotten, they must not stop
+// the next entry from running. Trees are printed as entered, folding would
+// show the tree of the result instead.
+func (r *repl) runFile(source string, file *lox.SourceFile) {
+	r.session.Source = file
+	r.session.OptLevel = r.config.OptLevel
+	if r.session.Mode == lox.ModeParse {
+		r.session.OptLevel = 0
+	}
+	r.session.Run(source)
+	r.session.HadError = false
+	r.session.HadRuntimeError = false
+	r.session.Errors = nil
+}
+
+// readInput keeps reading lines while a bracket or a string is left open.
+func readInput(editor *LineEditor) (string, error) {
+	prompt := "> "
+	var lines []string
+	for {
+		line, err := editor.ReadLine(prompt)
+		if err != nil {
+			return "", err
+		}
+		editor.AddHistory(line)
+
+		lines = append(lines, line)
+		input := strings.Join(lines, "\n")
+		if lox.IsComplete(input) {
+			return input, nil
+		}
+		prompt = "... "
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// runRepl feeds input to the REPL on a pipe, where there is no line editing,
+// and drops the prompts from the output.
+func runRepl(t *testing.T, input string, args ...string) string {
+	var stdout, stderr strings.Builder
+	cmd := exec.Command(golox, append([]string{"repl"}, args...)...)
+	cmd.Env = append(os.Environ(), "GOLOX_HISTORY=")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil || stderr.Len() > 0 {
+		t.Fatalf("%q: %v %s", input, err, stderr.String())
+	}
+	lines := strings.SplitAfter(stdout.String(), "\n")
+	for i, line := range lines {
+		for strings.HasPrefix(line, "> ") {
+			line = line[2:]
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "")
+}
+
+func TestReplCommands(t *testing.T) {
+	tests := []struct {
+		input  string
+		args   []string
+		output string
+	}{
+		{":ast 1 + 2 * 3\n", nil, "(+ 1.0 (* 2.0 3.0))\n"},
+		{":ast -(1)\n1 + 2\n", nil, "(- (group 1.0))\n3\n"},
+		{":tokens 1 + \"a\"\n", nil, "NUMBER 1 1.0\nPLUS + null\nSTRING \"a\" a\nEOF  null\n"},
+		{":mode\n:mode parse\n:mode\n1 + 2\n", nil, "evaluate\nparse\n(+ 1.0 2.0)\n"},
+		{":mode tokenize\n:ast !true\n1\n", nil, "(! true)\nNUMBER 1 1.0\nEOF  null\n"},
+		{"1 + 2\n", []string{"--mode=parse"}, "(+ 1.0 2.0)\n"},
+		{":help\n", nil, replHelp},
+	}
+	for _, test := range tests {
+		if output := runRepl(t, test.input, test.args...); output != test.output {
+			t.Errorf("%q: got %q, want %q", test.input, output, test.output)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+type termState struct{}
+
+// Without termios the REPL falls back to reading whole lines.
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
+
+func restoreTerm(fd int, state *termState) error {
+	return nil
+}
@@ -13,10 +13,10 @@ func main() {
 	}
 	outputDir := os.Args[1]
 	defineAst(outputDir, "Expr", []string{
-		"Ternary  : Condition Expr, TrueExpr Expr, FalseExpr Expr",
+		"Ternary  : Condition Expr, Question Token, TrueExpr Expr, FalseExpr Expr",
 		"Binary   : Left Expr, Operator Token, Right Expr",
-		"Grouping : Expression Expr",
-		"Literal  : Value any",
+		"Grouping : LeftParen Token, Expression Expr, RightParen Token",
+		"Literal  : Value any, Token Token",
 		"Unary    : Operator Token, Right Expr",
 	})
 }